@@ -0,0 +1,45 @@
+package keyfile
+
+import (
+	"strconv"
+	"strings"
+)
+
+// BoolSyntax is the set of words that the decoder accepts as booleans.
+type BoolSyntax int
+
+const (
+	// GoBoolSyntax accepts the values of strconv.ParseBool: 1, t, T, TRUE,
+	// true, True, 0, f, F, FALSE, false and False.
+	GoBoolSyntax BoolSyntax = iota
+	// GLibBoolSyntax accepts only true and false, like GLib.
+	GLibBoolSyntax
+	// ExtendedBoolSyntax accepts the values of GoBoolSyntax and yes, no, on,
+	// off, y and n, in any case.
+	ExtendedBoolSyntax
+)
+
+func parseBool(value string, syntax BoolSyntax) (bool, error) {
+	switch syntax {
+	case GLibBoolSyntax:
+		switch value {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+
+	case ExtendedBoolSyntax:
+		switch strings.ToLower(value) {
+		case "1", "t", "true", "y", "yes", "on":
+			return true, nil
+		case "0", "f", "false", "n", "no", "off":
+			return false, nil
+		}
+
+	default:
+		return strconv.ParseBool(value)
+	}
+
+	return false, &strconv.NumError{Func: "ParseBool", Num: value, Err: strconv.ErrSyntax}
+}
@@ -0,0 +1,75 @@
+package keyfile
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDecoderBoolSyntax(t *testing.T) {
+	tests := []struct {
+		syntax BoolSyntax
+		value  string
+		want   bool
+		fail   bool
+	}{
+		{syntax: GoBoolSyntax, value: "true", want: true},
+		{syntax: GoBoolSyntax, value: "1", want: true},
+		{syntax: GoBoolSyntax, value: "F", want: false},
+		{syntax: GoBoolSyntax, value: "yes", fail: true},
+		{syntax: GLibBoolSyntax, value: "false", want: false},
+		{syntax: GLibBoolSyntax, value: "TRUE", fail: true},
+		{syntax: GLibBoolSyntax, value: "1", fail: true},
+		{syntax: ExtendedBoolSyntax, value: "Yes", want: true},
+		{syntax: ExtendedBoolSyntax, value: "on", want: true},
+		{syntax: ExtendedBoolSyntax, value: "OFF", want: false},
+		{syntax: ExtendedBoolSyntax, value: "n", want: false},
+		{syntax: ExtendedBoolSyntax, value: "0", want: false},
+		{syntax: ExtendedBoolSyntax, value: "maybe", fail: true},
+	}
+
+	for _, tt := range tests {
+		var dst struct {
+			Group struct {
+				Value bool `keyfile:"value"`
+			} `keyfile:"group"`
+		}
+		dec := NewDecoder(strings.NewReader("[group]\nvalue=" + tt.value + "\n"))
+		dec.SetBoolSyntax(tt.syntax)
+		err := dec.Decode(&dst)
+
+		var parseErr ErrCanNotParsed
+		if tt.fail != errors.As(err, &parseErr) {
+			t.Fatalf("%d %q: got %v", tt.syntax, tt.value, err)
+		}
+		if dst.Group.Value != tt.want {
+			t.Fatalf("%d %q: got %v", tt.syntax, tt.value, dst.Group.Value)
+		}
+	}
+}
+
+func TestEncoderBoolValues(t *testing.T) {
+	model := struct {
+		Group struct {
+			Enabled  bool   `keyfile:"enabled"`
+			Disabled bool   `keyfile:"disabled"`
+			List     []bool `keyfile:"list"`
+		} `keyfile:"group"`
+	}{}
+	model.Group.Enabled = true
+	model.Group.List = []bool{true, false}
+
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	enc.SetBoolValues("yes", "no")
+	err := enc.Encode(model)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "[group]\ndisabled=no\nenabled=yes\nlist=yes;no\n"
+	if got := buf.String(); got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
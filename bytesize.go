@@ -0,0 +1,178 @@
+package keyfile
+
+import (
+	"errors"
+	"math"
+	"math/bits"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ByteSize is a number of bytes that is written with a unit, like 512MiB or
+// 10MB. Decimal units (kB, MB, GB, TB, PB, EB) are powers of 1000 and binary
+// units (KiB, MiB, GiB, TiB, PiB, EiB) are powers of 1024. When parsing, the
+// B of the unit is optional, units are case insensitive and the number may
+// have a fraction, like 1.5G.
+type ByteSize uint64
+
+var byteUnits = []struct {
+	name string
+	size uint64
+}{
+	{"EiB", 1 << 60}, {"EB", 1e18},
+	{"PiB", 1 << 50}, {"PB", 1e15},
+	{"TiB", 1 << 40}, {"TB", 1e12},
+	{"GiB", 1 << 30}, {"GB", 1e9},
+	{"MiB", 1 << 20}, {"MB", 1e6},
+	{"KiB", 1 << 10}, {"kB", 1e3},
+	{"B", 1},
+}
+
+var (
+	errInvalidByteSize = errors.New("invalid byte size")
+	errUnknownUnit     = errors.New(`unit must be "bytes"`)
+)
+
+// ParseByteSize parses a size like "512MiB", "10 MB", "1.5G" or "1024".
+func ParseByteSize(s string) (ByteSize, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if i == -1 {
+		i = len(s)
+	}
+	number, unit := s[:i], strings.TrimSpace(s[i:])
+
+	size := uint64(1)
+	if unit != "" {
+		size = 0
+		for _, u := range byteUnits {
+			if strings.EqualFold(unit, u.name) || strings.EqualFold(unit, strings.TrimSuffix(u.name, "B")) {
+				size = u.size
+				break
+			}
+		}
+		if size == 0 {
+			return 0, errInvalidByteSize
+		}
+	}
+
+	if !strings.Contains(number, ".") {
+		n, err := strconv.ParseUint(number, 10, 64)
+		if err != nil {
+			return 0, errInvalidByteSize
+		}
+		hi, lo := bits.Mul64(n, size)
+		if hi != 0 {
+			return 0, errInvalidByteSize
+		}
+		return ByteSize(lo), nil
+	}
+
+	f, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, errInvalidByteSize
+	}
+	f = math.Round(f * float64(size))
+	if f >= math.MaxUint64 {
+		return 0, errInvalidByteSize
+	}
+	return ByteSize(f), nil
+}
+
+// String returns the size in the unit that gives the smallest number with at
+// most three decimals, like 1.5KiB or 10MB.
+func (b ByteSize) String() string {
+	v := uint64(b)
+	for _, u := range byteUnits {
+		if v < u.size {
+			continue
+		}
+		rem := v % u.size
+		hi, lo := bits.Mul64(rem, 1000)
+		frac, r := bits.Div64(hi, lo, u.size)
+		if r != 0 {
+			continue
+		}
+
+		s := strconv.FormatUint(v/u.size, 10)
+		if frac != 0 {
+			s += "." + strings.TrimRight(strconv.FormatUint(frac+1000, 10)[1:], "0")
+		}
+		return s + u.name
+	}
+	return "0B"
+}
+
+func (b ByteSize) MarshalText() ([]byte, error) {
+	return []byte(b.String()), nil
+}
+
+func (b *ByteSize) UnmarshalText(text []byte) error {
+	size, err := ParseByteSize(string(text))
+	if err != nil {
+		return err
+	}
+	*b = size
+	return nil
+}
+
+// checkUnit returns an ErrInvalidOption for a unit option other than "bytes".
+func checkUnit(field reflect.StructField, unit string) error {
+	if unit != "bytes" {
+		return ErrInvalidOption{FieldName: field.Name, Option: "unit:" + unit, Err: errUnknownUnit}
+	}
+	return nil
+}
+
+// decodeUnit decodes the value of an integer field with a unit option.
+func decodeUnit(field reflect.StructField, rt reflect.Type, unit, value string) (reflect.Value, error) {
+	if err := checkUnit(field, unit); err != nil {
+		return reflect.Value{}, err
+	}
+	size, err := ParseByteSize(value)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+
+	v := reflect.New(rt).Elem()
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if size > math.MaxInt64 || v.OverflowInt(int64(size)) {
+			return reflect.Value{}, errInvalidByteSize
+		}
+		v.SetInt(int64(size))
+	default:
+		if v.OverflowUint(uint64(size)) {
+			return reflect.Value{}, errInvalidByteSize
+		}
+		v.SetUint(uint64(size))
+	}
+	return v, nil
+}
+
+// encodeUnit encodes the value of an integer field with a unit option.
+func encodeUnit(field reflect.StructField, rv reflect.Value, unit string) (string, error) {
+	if err := checkUnit(field, unit); err != nil {
+		return "", err
+	}
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if rv.Int() < 0 {
+			return "", errInvalidByteSize
+		}
+		return ByteSize(rv.Int()).String(), nil
+	}
+	return ByteSize(rv.Uint()).String(), nil
+}
+
+func isInteger(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
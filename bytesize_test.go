@@ -0,0 +1,125 @@
+package keyfile
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		src  string
+		want ByteSize
+		err  error
+	}{
+		{src: "1024", want: 1024},
+		{src: "0B", want: 0},
+		{src: "512MiB", want: 512 << 20},
+		{src: "512 mib", want: 512 << 20},
+		{src: "10MB", want: 10_000_000},
+		{src: "1.5G", want: 1_500_000_000},
+		{src: "1.5Ki", want: 1536},
+		{src: "2k", want: 2000},
+		{src: "16EiB", err: errInvalidByteSize},
+		{src: "-1MB", err: errInvalidByteSize},
+		{src: "1XB", err: errInvalidByteSize},
+		{src: "MB", err: errInvalidByteSize},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			got, err := ParseByteSize(tt.src)
+			if !errors.Is(err, tt.err) {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestByteSizeString(t *testing.T) {
+	tests := []struct {
+		size ByteSize
+		want string
+	}{
+		{size: 0, want: "0B"},
+		{size: 999, want: "999B"},
+		{size: 1000, want: "1kB"},
+		{size: 1536, want: "1.5KiB"},
+		{size: 512 << 20, want: "512MiB"},
+		{size: 10_000_000, want: "10MB"},
+		{size: 1_500_000_000, want: "1.5GB"},
+		{size: 1025, want: "1.025kB"},
+		{size: 1 << 63, want: "8EiB"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.size.String(); got != tt.want {
+			t.Fatalf("%d: got %q, want %q", tt.size, got, tt.want)
+		}
+		if size, err := ParseByteSize(tt.want); err != nil || size != tt.size {
+			t.Fatalf("%q: got %d, %v", tt.want, size, err)
+		}
+	}
+}
+
+func TestByteSizeFields(t *testing.T) {
+	type config struct {
+		Cache struct {
+			Size   ByteSize `keyfile:"size"`
+			Upload int64    `keyfile:"upload;unit:bytes"`
+			Parts  []uint32 `keyfile:"parts;unit:bytes"`
+			Small  uint8    `keyfile:"small;unit:bytes"`
+		} `keyfile:"cache"`
+	}
+
+	var src config
+	src.Cache.Size = 512 << 20
+	src.Cache.Upload = 10_000_000
+	src.Cache.Parts = []uint32{1 << 10, 1500}
+	src.Cache.Small = 200
+
+	data, err := Marshal(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "[cache]\nparts=1KiB;1.5kB\nsize=512MiB\nsmall=200B\nupload=10MB\n"
+	if string(data) != want {
+		t.Fatalf("got %q, want %q", data, want)
+	}
+
+	var dst config
+	if err := Unmarshal(data, &dst); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(dst, src) {
+		t.Fatalf("got %+v, want %+v", dst, src)
+	}
+
+	err = Unmarshal([]byte("[cache]\nsmall=1kB\n"), &dst)
+	if !errors.Is(err, errInvalidByteSize) {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestByteSizeUnknownUnit(t *testing.T) {
+	type config struct {
+		Cache struct {
+			Size int `keyfile:"size;unit:bits"`
+		} `keyfile:"cache"`
+	}
+	want := ErrInvalidOption{FieldName: "Size", Option: "unit:bits", Err: errUnknownUnit, Position: Position{LineNumber: 2, Column: 6, Group: "cache", Key: "size"}}
+
+	var dst config
+	err := Unmarshal([]byte("[cache]\nsize=1kB\n"), &dst)
+	if !errors.Is(err, want) {
+		t.Fatalf("decode: got %v, want %v", err, want)
+	}
+	want.Position = Position{Group: "cache", Key: "size"}
+	_, err = Marshal(dst)
+	if !errors.Is(err, want) {
+		t.Fatalf("encode: got %v, want %v", err, want)
+	}
+}
@@ -3,27 +3,36 @@ package keyfile
 import (
 	"bufio"
 	"cmp"
-	"fmt"
+	"encoding"
+	"errors"
 	"io"
 	"reflect"
-	"regexp"
 	"strconv"
 	"strings"
 )
 
 type Decoder struct {
 	r                *bufio.Reader
-	lineNumber       int
-	groups           map[string]map[string]map[string]string // map[groupName]map[key]map[subkey]value
+	doc              *Document
 	currentGroupName string
 	currentKeyName   string
 	currentField     reflect.StructField
+	currentNode      *Node
+	disallowUnknown  bool
+	allErrors        bool
+	integerLiterals  bool
+	boolSyntax       BoolSyntax
+	dialect          Dialect
+	fileName         string
+	errs             []error
+	missing          []error
+	decodedGroups    map[string]bool
+	decodedNodes     map[*Node]bool
 }
 
 func NewDecoder(r io.Reader) *Decoder {
 	return &Decoder{
-		r:      bufio.NewReader(r),
-		groups: make(map[string]map[string]map[string]string),
+		r: bufio.NewReader(r),
 	}
 }
 
@@ -43,6 +52,59 @@ func (dec *Decoder) Decode(v any) error {
 	return nil
 }
 
+// DisallowUnknownFields causes the Decoder to return an error when the input
+// contains groups or keys that do not match any exported, non-ignored field
+// of the destination. Every unknown entry is reported as an ErrUnknownGroup or
+// ErrUnknownKey, joined with errors.Join.
+func (dec *Decoder) DisallowUnknownFields() {
+	dec.disallowUnknown = true
+}
+
+// ReportAllErrors makes Decode continue after syntax and conversion errors
+// and return all of them at once, joined with errors.Join. Invalid lines are
+// skipped and fields that can not be parsed are left unchanged.
+func (dec *Decoder) ReportAllErrors() {
+	dec.allErrors = true
+}
+
+// UseIntegerLiterals makes the decoder accept integers written like Go
+// integer literals, such as 0x1F, 0o755, 0b101 and 1_000_000. Note that a
+// leading zero, as in 0755, then also denotes an octal number.
+func (dec *Decoder) UseIntegerLiterals() {
+	dec.integerLiterals = true
+}
+
+// SetBoolSyntax sets the words that are accepted as booleans. The default is
+// GoBoolSyntax.
+func (dec *Decoder) SetBoolSyntax(syntax BoolSyntax) {
+	dec.boolSyntax = syntax
+}
+
+// AllowRootKeys makes the decoder accept keys before the first group, as
+// found in many INI files. They belong to the root group, which has an empty
+// name, and are decoded into the struct field with the root option, like
+// `keyfile:",root"`, or into the fields of the model that are not groups.
+func (dec *Decoder) AllowRootKeys() {
+	dec.dialect.RootKeys = true
+}
+
+// SetDialect sets the syntax of the input, like INIDialect. The default is
+// GLibDialect. It replaces the options set by AllowRootKeys.
+func (dec *Decoder) SetDialect(dialect Dialect) {
+	dec.dialect = dialect
+}
+
+// SetFileName sets the file name that is reported in the position of errors.
+func (dec *Decoder) SetFileName(name string) {
+	dec.fileName = name
+}
+
+// Document returns the document read by the last call to Decode, including
+// its comments and the entries that were not decoded.
+func (dec *Decoder) Document() *Document {
+	return dec.doc
+}
+
 func (dec *Decoder) validateParameter(rv reflect.Value) error {
 	if rv.Kind() != reflect.Ptr {
 		return ErrParameterMustBePointer
@@ -52,7 +114,13 @@ func (dec *Decoder) validateParameter(rv reflect.Value) error {
 		return ErrParameterMustNotBeNil
 	}
 
-	if rv.Elem().Kind() != reflect.Struct {
+	switch rv.Elem().Kind() {
+	case reflect.Struct:
+	case reflect.Map:
+		if rv.Elem().Type().Key().Kind() != reflect.String {
+			return ErrInvalidMapKeyType
+		}
+	default:
 		return ErrInvalidParameterType
 	}
 
@@ -60,89 +128,66 @@ func (dec *Decoder) validateParameter(rv reflect.Value) error {
 }
 
 func (dec *Decoder) decode(rv reflect.Value) error {
+	dec.errs = nil
+	dec.missing = nil
+
 	err := dec.scanDocument()
 	if err != nil {
 		return err
 	}
 
-	err = dec.fillModel(rv)
+	if rv.Kind() == reflect.Map {
+		err = dec.fillMapModel(rv)
+	} else {
+		err = dec.fillModel(rv)
+	}
 	if err != nil {
 		return err
 	}
 
-	return nil
-}
-
-func (dec *Decoder) scanDocument() error {
-	for {
-		// Read line
-		lineRaw, err := dec.r.ReadString('\n')
-		if err != nil && err != io.EOF {
-			return fmt.Errorf("read line: %w", err)
-		}
-		dec.lineNumber++
-
-		// The end of the file
-		if err == io.EOF && lineRaw == "" {
-			break
-		}
-
-		// Trim line
-		line := strings.TrimRight(lineRaw, "\r\n")
-		line = strings.TrimSpace(line)
-
-		// Ignore empty line
-		if line == "" {
-			continue
-		}
-
-		// Ignore comments
-		if strings.HasPrefix(line, "#") {
-			continue
-		}
-
-		// Get group name
-		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
-			dec.currentGroupName = strings.Trim(line, "[]")
-			dec.currentGroupName = strings.TrimSpace(dec.currentGroupName)
-			if dec.currentGroupName == "" {
-				return ErrInvalidGroupName{Line: line, LineNumber: dec.lineNumber}
-			}
-
-			dec.groups[dec.currentGroupName] = make(map[string]map[string]string)
-			continue
-		}
-
-		// Get key-value pair
-		parts := strings.SplitN(line, "=", 2)
-
-		if len(parts) != 2 {
-			return ErrInvalidEntry{Line: line, LineNumber: dec.lineNumber}
-		}
-
-		key := strings.TrimSpace(parts[0])
-		subkey := ""
-
-		if sm := mapValueRgx.FindStringSubmatch(key); len(sm) == 3 {
-			key = sm[1]
-			subkey = sm[2]
-		}
+	err = dec.report(errors.Join(dec.missing...))
+	if err != nil {
+		return err
+	}
 
-		if key == "" {
-			return ErrInvalidKey{Line: line, LineNumber: dec.lineNumber}
-		}
+	err = dec.report(validateModel(rv))
+	if err != nil {
+		return err
+	}
 
-		if dec.currentGroupName == "" {
-			return ErrKeyValuePairMustBeContainedInAGroup{Line: line, LineNumber: dec.lineNumber}
+	if dec.disallowUnknown {
+		err = dec.report(dec.unknownFields())
+		if err != nil {
+			return err
 		}
+	}
 
-		if _, ok := dec.groups[dec.currentGroupName][key]; !ok {
-			dec.groups[dec.currentGroupName][key] = make(map[string]string)
-		}
+	return errors.Join(dec.errs...)
+}
 
-		dec.groups[dec.currentGroupName][key][subkey] = unescape(strings.TrimSpace(parts[1]))
+// report returns the error, or records it to be returned at the end of Decode
+// if all errors are reported.
+func (dec *Decoder) report(err error) error {
+	if err == nil || !dec.allErrors {
+		return err
 	}
+	dec.errs = append(dec.errs, err)
+	return nil
+}
 
+func (dec *Decoder) scanDocument() error {
+	p := newParser(dec.r)
+	p.fileName = dec.fileName
+	p.allErrors = dec.allErrors
+	p.doc.dialect = dec.dialect
+	err := p.parse()
+	if err != nil && !dec.allErrors {
+		return err
+	}
+	dec.errs = append(dec.errs, p.errs...)
+	dec.doc = p.doc
+	dec.decodedGroups = make(map[string]bool)
+	dec.decodedNodes = make(map[*Node]bool)
 	return nil
 }
 
@@ -156,19 +201,76 @@ func (dec *Decoder) fillModel(model reflect.Value) error {
 			continue
 		}
 
+		// The field with the root option holds the root group
+		if isRoot(groupType.Tag) {
+			dec.currentGroupName = ""
+			dec.decodedGroups[""] = true
+			root, err := dec.decodeGroup(group.Type())
+			if err != nil {
+				return err
+			}
+			group.Set(root)
+			continue
+		}
+
+		// The other fields that are not groups hold the keys of the root group
+		if dec.dialect.RootKeys && !isGroupType(groupType.Type) {
+			dec.currentGroupName = ""
+			dec.currentField = groupType
+			dec.decodedGroups[""] = true
+			err := dec.report(dec.fillField(group, ""))
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
 		// check group type
 		if !(group.Kind() == reflect.Struct ||
-			(group.Kind() == reflect.Pointer && group.Type().Elem().Kind() == reflect.Struct)) {
-			return ErrInvalidGroupType{GroupName: groupType.Name, GroupType: group.Kind().String()}
+			(group.Kind() == reflect.Pointer && group.Type().Elem().Kind() == reflect.Struct) ||
+			((group.Kind() == reflect.Map || group.Kind() == reflect.Slice) && isGroupType(group.Type()))) {
+			err := dec.report(ErrInvalidGroupType{
+				GroupName: groupType.Name,
+				GroupType: group.Kind().String(),
+				Position:  dec.groupPosition(cmp.Or(getKeyName(groupType.Tag), groupType.Name)),
+			})
+			if err != nil {
+				return err
+			}
+			continue
 		}
 
 		// get group name
 		dec.currentGroupName = cmp.Or(getKeyName(groupType.Tag), groupType.Name)
 
-		// check group exists
-		if _, ok := dec.groups[dec.currentGroupName]; !ok {
+		// a map or a slice collects the groups that match the name
+		if group.Kind() == reflect.Map || group.Kind() == reflect.Slice {
+			pattern := dec.currentGroupName
+			found, err := dec.fillGroups(group, pattern)
+			if err != nil {
+				return err
+			}
+			if !found && isRequired(groupType.Tag) {
+				dec.missing = append(dec.missing, ErrMissingRequired{Position: dec.groupPosition(pattern)})
+			}
+			continue
+		}
+
+		// check group exists, missing struct groups still get their defaults
+		if !dec.doc.hasGroup(dec.currentGroupName) {
+			if isRequired(groupType.Tag) {
+				dec.missing = append(dec.missing, ErrMissingRequired{Position: dec.groupPosition(dec.currentGroupName)})
+				continue
+			}
+			if group.Kind() == reflect.Struct {
+				err := dec.fillGroup(group)
+				if err != nil {
+					return err
+				}
+			}
 			continue
 		}
+		dec.decodedGroups[dec.dialect.foldGroup(dec.currentGroupName)] = true
 
 		// if group is a pointer to struct
 		if group.Kind() == reflect.Ptr {
@@ -192,18 +294,179 @@ func (dec *Decoder) fillModel(model reflect.Value) error {
 	return nil
 }
 
+// fillMapModel decodes every group of the document into a map of groups. Root
+// keys are decoded into the group with the empty name.
+func (dec *Decoder) fillMapModel(model reflect.Value) error {
+	if model.IsNil() {
+		model.Set(reflect.MakeMap(model.Type()))
+	}
+	names := dec.doc.GetGroups()
+	if keys, _ := dec.doc.GetKeys(""); len(keys) > 0 {
+		names = append([]string{""}, names...)
+	}
+	for _, name := range names {
+		dec.currentGroupName = name
+		dec.decodedGroups[dec.dialect.foldGroup(name)] = true
+
+		group, err := dec.decodeGroup(model.Type().Elem())
+		if err != nil {
+			return err
+		}
+		model.SetMapIndex(reflect.ValueOf(name).Convert(model.Type().Key()), group)
+	}
+	return nil
+}
+
+// fillGroups decodes the groups that match the pattern into a map or a
+// slice. A pattern with a "*" matches the groups with any text in its place,
+// like "Desktop Action *", and a pattern without one matches subgroups like
+// `remote "origin"` of the group "remote". Maps are keyed by the matched
+// text, which is also stored in the wildcard field of the group. It reports
+// whether any group matched.
+func (dec *Decoder) fillGroups(field reflect.Value, pattern string) (bool, error) {
+	rt := field.Type()
+	var groups reflect.Value
+	if rt.Kind() == reflect.Map {
+		groups = reflect.MakeMap(rt)
+	} else {
+		groups = reflect.MakeSlice(rt, 0, 0)
+	}
+
+	for _, name := range dec.doc.GetGroups() {
+		matched, ok := matchGroup(name, pattern, dec.dialect.CaseInsensitive)
+		if !ok {
+			continue
+		}
+		dec.currentGroupName = name
+		dec.decodedGroups[dec.dialect.foldGroup(name)] = true
+
+		group, err := dec.decodeGroup(rt.Elem())
+		if err != nil {
+			return false, err
+		}
+		setWildcard(group, matched)
+
+		if rt.Kind() == reflect.Map {
+			groups.SetMapIndex(reflect.ValueOf(matched).Convert(rt.Key()), group)
+		} else {
+			groups = reflect.Append(groups, group)
+		}
+	}
+
+	if groups.Len() == 0 {
+		return false, nil
+	}
+	field.Set(groups)
+	return true, nil
+}
+
+// decodeGroup decodes the current group into a new value of rt, which is a
+// struct, a pointer to a struct, a map of keys to values or any.
+func (dec *Decoder) decodeGroup(rt reflect.Type) (reflect.Value, error) {
+	mapType := reflect.TypeFor[map[string]any]()
+
+	switch {
+	case rt.Kind() == reflect.Struct:
+		group := reflect.New(rt).Elem()
+		return group, dec.fillGroup(group)
+
+	case rt.Kind() == reflect.Pointer && rt.Elem().Kind() == reflect.Struct:
+		group := reflect.New(rt.Elem())
+		return group, dec.fillGroup(group.Elem())
+
+	case rt.Kind() == reflect.Map && rt.Key().Kind() == reflect.String:
+		return dec.fillGroupMap(rt)
+
+	case rt.Kind() == reflect.Interface && mapType.AssignableTo(rt):
+		return dec.fillGroupMap(mapType)
+	}
+
+	return reflect.Value{}, ErrInvalidGroupType{
+		GroupName: dec.currentGroupName,
+		GroupType: rt.String(),
+		Position:  dec.groupPosition(dec.currentGroupName),
+	}
+}
+
+// groupPosition returns the position of the header of the group, or only the
+// name of the group if it is not in the input.
+func (dec *Decoder) groupPosition(name string) Position {
+	if group := dec.doc.Group(name); group != nil {
+		return group.header.position(dec.fileName, name)
+	}
+	return Position{FileName: dec.fileName, Group: name}
+}
+
+// fillGroupMap decodes every key of the current group into a map. Locale
+// variants are stored under their full key, like "Name[de]".
+func (dec *Decoder) fillGroupMap(rt reflect.Type) (reflect.Value, error) {
+	m := reflect.MakeMap(rt)
+	for _, group := range dec.doc.groupsNamed(dec.currentGroupName) {
+		for _, node := range group.nodes {
+			if node.kind != EntryNode || dec.doc.lookup(dec.currentGroupName, node.key, node.locale) != node {
+				continue
+			}
+			dec.decodedNodes[node] = true
+			dec.currentNode = node
+			dec.currentKeyName = node.fullKey()
+			dec.currentField = reflect.StructField{Name: dec.currentKeyName, Type: rt.Elem()}
+
+			v, err := dec.decodeValue(rt.Elem(), node.value)
+			if err != nil {
+				err = dec.report(dec.valueError(err))
+				if err != nil {
+					return reflect.Value{}, err
+				}
+				continue
+			}
+			m.SetMapIndex(reflect.ValueOf(dec.currentKeyName).Convert(rt.Key()), v)
+		}
+	}
+	return m, nil
+}
+
 func (dec *Decoder) fillGroup(group reflect.Value) error {
+	err := dec.fillFields(group, "")
+	if err != nil {
+		return err
+	}
+	return dec.report(dec.validateGroup(group))
+}
+
+// fillFields fills the fields of a group, or of a struct nested in it whose
+// keys start with prefix.
+func (dec *Decoder) fillFields(group reflect.Value, prefix string) error {
 	for i := range group.NumField() {
 		field := group.Field(i)
 		fieldType := group.Type().Field(i)
-		// Skip unexported or ignored groups
-		if !fieldType.IsExported() || isIgnored(fieldType.Tag) {
+
+		// Embedded and inline structs share the keys of the group
+		if isInline(fieldType) {
+			err := dec.fillStruct(field, prefix)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Skip unexported or ignored groups, and the wildcard field
+		if !fieldType.IsExported() || isIgnored(fieldType.Tag) || isWildcard(fieldType.Tag) {
+			continue
+		}
+
+		// Nested structs hold keys like "db.host"
+		if isNestedStruct(fieldType.Type) {
+			name := cmp.Or(getKeyName(fieldType.Tag), fieldType.Name)
+			err := dec.fillStruct(field, prefix+name+".")
+			if err != nil {
+				return err
+			}
 			continue
 		}
 
 		dec.currentField = fieldType
 
-		err := dec.fillField(field)
+		err := dec.report(dec.fillField(field, prefix))
 		if err != nil {
 			return err
 		}
@@ -212,31 +475,222 @@ func (dec *Decoder) fillGroup(group reflect.Value) error {
 	return nil
 }
 
-func (dec *Decoder) fillField(field reflect.Value) error {
+// fillStruct fills an embedded or nested struct. A nil pointer to the struct
+// is allocated only if any of its keys is in the group, so that it stays nil
+// otherwise.
+func (dec *Decoder) fillStruct(field reflect.Value, prefix string) error {
+	if field.Kind() != reflect.Pointer {
+		return dec.fillFields(field, prefix)
+	}
+	if !field.IsNil() {
+		return dec.fillFields(field.Elem(), prefix)
+	}
+
+	v := reflect.New(field.Type().Elem())
+	decoded := len(dec.decodedNodes)
+	err := dec.fillFields(v.Elem(), prefix)
+	if err != nil {
+		return err
+	}
+	if len(dec.decodedNodes) > decoded {
+		field.Set(v)
+	}
+	return nil
+}
+
+func (dec *Decoder) fillField(field reflect.Value, prefix string) error {
 	// get key
-	dec.currentKeyName = cmp.Or(getKeyName(dec.currentField.Tag), dec.currentField.Name)
+	dec.currentKeyName = prefix + cmp.Or(getKeyName(dec.currentField.Tag), dec.currentField.Name)
+
+	// check key exists, missing keys are decoded from their default. Keys
+	// are only required in groups that are present.
+	raw, hasDefault := getDefault(dec.currentField.Tag)
+	isMap := field.Kind() == reflect.Map
+	if !dec.isKeyExists(dec.currentGroupName, dec.currentKeyName, isMap) {
+		if isRequired(dec.currentField.Tag) && dec.doc.hasGroup(dec.currentGroupName) {
+			dec.missing = append(dec.missing, ErrMissingRequired{Position: Position{FileName: dec.fileName, Group: dec.currentGroupName, Key: dec.currentKeyName}})
+			return nil
+		}
+		if !hasDefault {
+			return nil
+		}
+	}
 
-	// check key exists
-	if !dec.isKeyExists(dec.currentGroupName, dec.currentKeyName, field.Kind() == reflect.Map) {
-		return nil
+	for _, node := range dec.doc.entries(dec.currentGroupName, dec.currentKeyName) {
+		if isMap || node.locale == "" {
+			dec.decodedNodes[node] = true
+		}
+	}
+
+	dec.currentNode = dec.doc.lookup(dec.currentGroupName, dec.currentKeyName, "")
+	if dec.currentNode != nil {
+		raw = dec.currentNode.value
 	}
 
-	val, err := dec.decodeValue(field.Type(), dec.getValue(dec.currentGroupName, dec.currentKeyName))
+	var val reflect.Value
+	var err error
+	if dec.dialect.Duplicates == AppendDuplicateKeys && field.Kind() == reflect.Slice && dec.currentNode != nil {
+		val, err = dec.decodeAppended(field.Type())
+	} else {
+		val, err = dec.decodeValue(field.Type(), raw)
+	}
 	if err != nil {
-		return ErrCanNotParsed{
-			Err:        err,
-			SourceKey:  dec.currentKeyName,
-			TargetName: dec.currentField.Name,
-			TargetType: dec.currentField.Type.String(),
-		}
+		return dec.valueError(err)
 	}
 
 	field.Set(val)
 
-	return nil
+	dec.currentNode = dec.doc.lookup(dec.currentGroupName, dec.currentKeyName, "")
+	return dec.validateField(field)
 }
 
-func (dec *Decoder) decodeValue(rt reflect.Type, value string) (reflect.Value, error) {
+// valueError returns the error of decoding the value of the current key.
+func (dec *Decoder) valueError(err error) error {
+	var escapeErr ErrInvalidEscape
+	if errors.As(err, &escapeErr) {
+		return escapeErr
+	}
+	var optionErr ErrInvalidOption
+	if errors.As(err, &optionErr) {
+		optionErr.Position = dec.position()
+		return optionErr
+	}
+	return ErrCanNotParsed{
+		Err:        err,
+		SourceKey:  dec.currentKeyName,
+		TargetName: dec.currentField.Name,
+		TargetType: dec.currentField.Type.String(),
+		Position:   dec.position(),
+	}
+}
+
+// decodeValue decodes the raw, still escaped value of the current key.
+func (dec *Decoder) decodeValue(rt reflect.Type, raw string) (reflect.Value, error) {
+	if !isUnmarshaler(rt) && !isTimeType(rt) {
+		switch rt.Kind() {
+		case reflect.Slice:
+			return dec.decodeList(rt, raw)
+
+		case reflect.Map:
+			return dec.decodeMap(rt, raw)
+
+		case reflect.Pointer:
+			ptr := reflect.New(rt.Elem())
+			v, err := dec.decodeValue(rt.Elem(), raw)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			ptr.Elem().Set(v)
+			return ptr, nil
+		}
+	}
+
+	value, err := dec.unescape(raw, 0, "")
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	return dec.decodeScalar(rt, value)
+}
+
+func (dec *Decoder) decodeList(rt reflect.Type, raw string) (reflect.Value, error) {
+	sep := cmp.Or(getSeperator(dec.currentField.Tag), dec.dialect.listSeparator())
+	elems := splitList(raw, sep, dec.dialect.LiteralBackslashes)
+	slice := reflect.MakeSlice(rt, 0, len(elems))
+
+	offset := 0
+	for i := range elems {
+		lead := len(elems[i]) - len(strings.TrimLeft(elems[i], " \t"))
+		elem, err := dec.unescape(trimBlank(elems[i]), offset+lead, sep)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		offset += len(elems[i]) + len(sep)
+
+		// Blank separated lists may have more than one blank between elements
+		if trimBlank(sep) == "" && elems[i] == "" {
+			continue
+		}
+		v, err := dec.decodeScalar(rt.Elem(), elem)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		slice = reflect.Append(slice, v)
+	}
+	return slice, nil
+}
+
+// decodeAppended decodes every definition of the current key into one list.
+// An empty value clears the elements defined before it. With the lines
+// option, every definition is one element instead of a list.
+func (dec *Decoder) decodeAppended(rt reflect.Type) (reflect.Value, error) {
+	lines := isLines(dec.currentField.Tag)
+	list := reflect.MakeSlice(rt, 0, 0)
+	for _, node := range dec.doc.entries(dec.currentGroupName, dec.currentKeyName) {
+		if node.locale != "" {
+			continue
+		}
+		if node.value == "" {
+			list = reflect.MakeSlice(rt, 0, 0)
+			continue
+		}
+		dec.currentNode = node
+		if lines {
+			elem, err := dec.decodeValue(rt.Elem(), node.value)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			list = reflect.Append(list, elem)
+			continue
+		}
+		elems, err := dec.decodeValue(rt, node.value)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		list = reflect.AppendSlice(list, elems)
+	}
+	return list, nil
+}
+
+// decodeMap decodes the locale variants of the current key. The default value
+// of the field is used for the untranslated entry if it is missing.
+func (dec *Decoder) decodeMap(rt reflect.Type, raw string) (reflect.Value, error) {
+	if rt.Key().Kind() != reflect.String {
+		return reflect.Value{}, ErrInvalidMapKeyType
+	}
+	m := reflect.MakeMap(rt)
+	locales := dec.doc.locales(dec.currentGroupName, dec.currentKeyName)
+	for subkey, node := range locales {
+		dec.currentNode = node
+		v, err := dec.decodeValue(rt.Elem(), node.Value())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		m.SetMapIndex(reflect.ValueOf(subkey).Convert(rt.Key()), v)
+	}
+
+	if _, ok := locales[""]; !ok {
+		if _, hasDefault := getDefault(dec.currentField.Tag); hasDefault {
+			dec.currentNode = nil
+			v, err := dec.decodeValue(rt.Elem(), raw)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			m.SetMapIndex(reflect.ValueOf("").Convert(rt.Key()), v)
+		}
+	}
+	return m, nil
+}
+
+// decodeScalar decodes an unescaped value or list element.
+func (dec *Decoder) decodeScalar(rt reflect.Type, value string) (reflect.Value, error) {
+	if isTimeType(rt) {
+		return dec.decodeTime(rt, value)
+	}
+
+	if unit, ok := getOption(dec.currentField.Tag, "unit"); ok && isInteger(rt.Kind()) {
+		return decodeUnit(dec.currentField, rt, unit, value)
+	}
+
 	if reflect.PointerTo(rt).Implements(reflect.TypeFor[Unmarshaler]()) {
 		v := reflect.New(rt)
 		result := v.MethodByName("UnmarshalKeyFile").Call([]reflect.Value{
@@ -248,6 +702,15 @@ func (dec *Decoder) decodeValue(rt reflect.Type, value string) (reflect.Value, e
 		return v.Elem(), nil
 	}
 
+	if reflect.PointerTo(rt).Implements(reflect.TypeFor[encoding.TextUnmarshaler]()) {
+		v := reflect.New(rt)
+		err := v.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(value))
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		return v.Elem(), nil
+	}
+
 	switch rt.Kind() {
 	case reflect.Interface:
 		return dec.decodeAnyValue(value), nil
@@ -256,14 +719,22 @@ func (dec *Decoder) decodeValue(rt reflect.Type, value string) (reflect.Value, e
 		return reflect.ValueOf(value).Convert(rt), nil
 
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		v, err := strconv.ParseInt(value, 10, 64)
+		base, err := integerBase(dec.currentField, dec.integerLiterals)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		v, err := parseInt(value, base, allowsIntegerPrefix(dec.currentField, dec.integerLiterals))
 		if err != nil {
 			return reflect.Value{}, err
 		}
 		return reflect.ValueOf(v).Convert(rt), nil
 
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-		v, err := strconv.ParseUint(value, 10, 64)
+		base, err := integerBase(dec.currentField, dec.integerLiterals)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		v, err := parseUint(value, base, allowsIntegerPrefix(dec.currentField, dec.integerLiterals))
 		if err != nil {
 			return reflect.Value{}, err
 		}
@@ -284,44 +755,15 @@ func (dec *Decoder) decodeValue(rt reflect.Type, value string) (reflect.Value, e
 		return reflect.ValueOf(v).Convert(rt), nil
 
 	case reflect.Bool:
-		v, err := strconv.ParseBool(value)
+		v, err := parseBool(value, dec.boolSyntax)
 		if err != nil {
 			return reflect.Value{}, err
 		}
 		return reflect.ValueOf(v).Convert(rt), nil
 
-	case reflect.Slice:
-		sep := cmp.Or(getSeperator(dec.currentField.Tag), ";")
-		elems := split(value, sep)
-		slice := reflect.MakeSlice(rt, 0, len(elems))
-
-		for i := range elems {
-			elem := strings.TrimSpace(elems[i])
-			v, err := dec.decodeValue(rt.Elem(), elem)
-			if err != nil {
-				return reflect.Value{}, err
-			}
-			slice = reflect.Append(slice, v)
-		}
-		return slice, nil
-
-	case reflect.Map:
-		if rt.Key().Kind() != reflect.String {
-			return reflect.Value{}, ErrInvalidMapKeyType
-		}
-		m := reflect.MakeMap(rt)
-		for subkey, mapValue := range dec.getMapValue(dec.currentGroupName, dec.currentKeyName) {
-			v, err := dec.decodeValue(rt.Elem(), mapValue)
-			if err != nil {
-				return reflect.Value{}, err
-			}
-			m.SetMapIndex(reflect.ValueOf(subkey), v)
-		}
-		return m, nil
-
 	case reflect.Pointer:
 		ptr := reflect.New(rt.Elem())
-		v, err := dec.decodeValue(ptr.Type().Elem(), value)
+		v, err := dec.decodeScalar(rt.Elem(), value)
 		if err != nil {
 			return reflect.Value{}, err
 		}
@@ -332,6 +774,33 @@ func (dec *Decoder) decodeValue(rt reflect.Type, value string) (reflect.Value, e
 	return reflect.Value{}, ErrUnsupportedValueType{}
 }
 
+// isUnmarshaler reports whether values of the type decode themselves, so that
+// types like net.IP are not decoded as lists.
+func isUnmarshaler(rt reflect.Type) bool {
+	return reflect.PointerTo(rt).Implements(reflect.TypeFor[Unmarshaler]()) ||
+		reflect.PointerTo(rt).Implements(reflect.TypeFor[encoding.TextUnmarshaler]())
+}
+
+// unescape unescapes a value of the current node and reports invalid escape
+// sequences with the position of the node.
+func (dec *Decoder) unescape(value string, offset int, sep string) (string, error) {
+	pos := dec.position()
+	pos.Column += offset
+	line := ""
+	if dec.currentNode != nil {
+		line = dec.currentNode.line()
+	}
+	return unescapeAt(value, sep, dec.dialect, pos, line)
+}
+
+// position returns the position of the value of the current node.
+func (dec *Decoder) position() Position {
+	if dec.currentNode == nil {
+		return Position{FileName: dec.fileName, Group: dec.currentGroupName, Key: dec.currentKeyName}
+	}
+	return dec.currentNode.valuePosition(dec.fileName, dec.currentGroupName)
+}
+
 func (dec *Decoder) decodeAnyValue(value string) reflect.Value {
 	if val, err := strconv.ParseInt(value, 10, 64); err == nil {
 		return reflect.ValueOf(val)
@@ -339,7 +808,7 @@ func (dec *Decoder) decodeAnyValue(value string) reflect.Value {
 	if val, err := strconv.ParseFloat(value, 64); err == nil {
 		return reflect.ValueOf(val)
 	}
-	if val, err := strconv.ParseBool(value); err == nil {
+	if val, err := parseBool(value, dec.boolSyntax); err == nil {
 		return reflect.ValueOf(val)
 	}
 	if val, err := strconv.ParseComplex(value, 64); err == nil {
@@ -348,37 +817,27 @@ func (dec *Decoder) decodeAnyValue(value string) reflect.Value {
 	return reflect.ValueOf(value)
 }
 
-var mapValueRgx = regexp.MustCompile(`(.*)\[(.*)\]`)
-
-func (dec *Decoder) isKeyExists(groupName, key string, isMap bool) bool {
-	_, ok := dec.groups[groupName]
-	if !ok {
-		return false
-	}
-
-	if !isMap {
-		_, ok = dec.groups[groupName][key]
-		return ok
-	}
-
-	for k := range dec.groups[groupName] {
-		if k == key {
-			return true
+// unknownFields returns the groups and keys of the document that were not
+// matched by any field.
+func (dec *Decoder) unknownFields() error {
+	errs := make([]error, 0)
+	for _, group := range dec.doc.groups {
+		if group.header != nil && !dec.decodedGroups[dec.dialect.foldGroup(group.name)] {
+			errs = append(errs, ErrUnknownGroup{Position: group.header.position(dec.fileName, group.name)})
+			continue
 		}
-
-		sm := mapValueRgx.FindStringSubmatch(k)
-		if len(sm) == 3 && sm[1] == key {
-			return true
+		for _, node := range group.nodes {
+			if node.kind == EntryNode && !dec.decodedNodes[node] {
+				errs = append(errs, ErrUnknownKey{Position: node.position(dec.fileName, group.name)})
+			}
 		}
 	}
-
-	return false
-}
-
-func (dec *Decoder) getValue(groupName, key string) string {
-	return dec.groups[groupName][key][""]
+	return errors.Join(errs...)
 }
 
-func (dec *Decoder) getMapValue(groupName, key string) map[string]string {
-	return dec.groups[groupName][key]
+func (dec *Decoder) isKeyExists(groupName, key string, isMap bool) bool {
+	if !isMap {
+		return dec.doc.lookup(groupName, key, "") != nil
+	}
+	return len(dec.doc.locales(groupName, key)) > 0
 }
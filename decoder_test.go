@@ -2,8 +2,11 @@ package keyfile
 
 import (
 	"errors"
+	"io"
 	"reflect"
+	"strings"
 	"testing"
+	"testing/iotest"
 )
 
 func TestDecoder(t *testing.T) {
@@ -76,6 +79,54 @@ func TestDecoder(t *testing.T) {
 			},
 			err: nil,
 		},
+		{
+			name: "escaped backslash",
+			src: `[example]
+						key1 = \\n
+						key2 = C:\\Windows\\
+						key3 = a\sb\s`,
+			dst: &struct {
+				Example struct {
+					Key1 string `keyfile:"key1"`
+					Key2 string `keyfile:"key2"`
+					Key3 string `keyfile:"key3"`
+				} `keyfile:"example"`
+			}{},
+			want: &struct {
+				Example struct {
+					Key1 string `keyfile:"key1"`
+					Key2 string `keyfile:"key2"`
+					Key3 string `keyfile:"key3"`
+				} `keyfile:"example"`
+			}{
+				Example: struct {
+					Key1 string `keyfile:"key1"`
+					Key2 string `keyfile:"key2"`
+					Key3 string `keyfile:"key3"`
+				}{
+					Key1: "\\n",
+					Key2: "C:\\Windows\\",
+					Key3: "a b ",
+				},
+			},
+			err: nil,
+		},
+		{
+			name: "invalid escape",
+			src: `[example]
+key1 = C:\Windows`,
+			dst: &struct {
+				Example struct {
+					Key1 string `keyfile:"key1"`
+				} `keyfile:"example"`
+			}{},
+			want: &struct {
+				Example struct {
+					Key1 string `keyfile:"key1"`
+				} `keyfile:"example"`
+			}{},
+			err: ErrInvalidEscape{Line: `key1 = C:\Windows`, Sequence: `\W`, Position: Position{LineNumber: 2, Column: 10, Group: "example", Key: "key1"}},
+		},
 		{
 			name: "bool field",
 			src: `[example]
@@ -437,6 +488,28 @@ func TestDecoder(t *testing.T) {
 			},
 			err: nil,
 		},
+		{
+			name: "map field without untranslated value",
+			src: `[example]
+						greet[de] = hallo`,
+			dst: &struct {
+				Example struct {
+					Greet map[string]string `keyfile:"greet"`
+				} `keyfile:"example"`
+			}{},
+			want: &struct {
+				Example struct {
+					Greet map[string]string `keyfile:"greet"`
+				} `keyfile:"example"`
+			}{
+				Example: struct {
+					Greet map[string]string `keyfile:"greet"`
+				}{
+					Greet: map[string]string{"de": "hallo"},
+				},
+			},
+			err: nil,
+		},
 		{
 			name: "unexported group",
 			src: `[example]
@@ -539,3 +612,470 @@ func TestDecoder(t *testing.T) {
 		})
 	}
 }
+
+func TestDecoderDisallowUnknownFields(t *testing.T) {
+	type config struct {
+		General struct {
+			Verbose bool              `keyfile:"verbose"`
+			Name    map[string]string `keyfile:"name"`
+			Ignored string            `keyfile:"-"`
+		} `keyfile:"general"`
+	}
+
+	tests := []struct {
+		name string
+		src  string
+		errs []error
+	}{
+		{
+			name: "known fields",
+			src:  "[general]\nverbose=true\nname[de]=Name\n",
+		},
+		{
+			name: "unknown entries",
+			src:  "[general]\nverbos=true\nIgnored=value\nname=Name\n[other]\nkey=value\n[general]\nverbose[de]=wahr\n",
+			errs: []error{
+				ErrUnknownKey{Position: Position{LineNumber: 2, Column: 1, Group: "general", Key: "verbos"}},
+				ErrUnknownKey{Position: Position{LineNumber: 3, Column: 1, Group: "general", Key: "Ignored"}},
+				ErrUnknownGroup{Position: Position{LineNumber: 5, Column: 1, Group: "other"}},
+				ErrUnknownKey{Position: Position{LineNumber: 8, Column: 1, Group: "general", Key: "verbose[de]"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var dst config
+			dec := NewDecoder(strings.NewReader(tt.src))
+			dec.DisallowUnknownFields()
+			err := dec.Decode(&dst)
+			if len(tt.errs) == 0 && err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.errs {
+				if !errors.Is(err, want) {
+					t.Fatalf("%v does not contain %v", err, want)
+				}
+			}
+			if err != nil && len(err.(interface{ Unwrap() []error }).Unwrap()) != len(tt.errs) {
+				t.Fatalf("unexpected errors: %v", err)
+			}
+		})
+	}
+}
+
+func TestDecoderMetaData(t *testing.T) {
+	src := `[server]
+port = 0
+host = localhost
+host = example.com
+name[de] = Name
+
+[other]
+key = value
+`
+	var dst struct {
+		Server struct {
+			Port    int    `keyfile:"port"`
+			Host    string `keyfile:"host"`
+			Timeout int    `keyfile:"timeout"`
+		} `keyfile:"server"`
+	}
+
+	dec := NewDecoder(strings.NewReader(src))
+	err := dec.Decode(&dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := dec.MetaData()
+
+	if !md.IsDefined("server", "port") || md.IsDefined("server", "timeout") || !md.IsDefined("other", "") {
+		t.Fatal("is defined")
+	}
+	if line := md.LineNumber("server", "host"); line != 4 {
+		t.Fatalf("got line %d", line)
+	}
+
+	wantKeys := []Key{
+		{Group: "server", Key: "port", LineNumber: 2},
+		{Group: "server", Key: "host", LineNumber: 4},
+		{Group: "server", Key: "name", Locale: "de", LineNumber: 5},
+		{Group: "other", Key: "key", LineNumber: 8},
+	}
+	if keys := md.Keys(); !reflect.DeepEqual(keys, wantKeys) {
+		t.Fatalf("got keys %v", keys)
+	}
+
+	wantUndecoded := []Key{
+		{Group: "server", Key: "name", Locale: "de", LineNumber: 5},
+		{Group: "other", Key: "key", LineNumber: 8},
+	}
+	if keys := md.Undecoded(); !reflect.DeepEqual(keys, wantUndecoded) {
+		t.Fatalf("got undecoded %v", keys)
+	}
+}
+
+func TestDecoderReportAllErrors(t *testing.T) {
+	src := `orphan = 1
+[server]
+port = eighty
+host
+name = C:\Windows
+[ ]
+ignored = true
+[client]
+retries = 3
+timeout = soon
+`
+	var dst struct {
+		Server struct {
+			Port int    `keyfile:"port"`
+			Name string `keyfile:"name"`
+		} `keyfile:"server"`
+		Client struct {
+			Retries int `keyfile:"retries"`
+			Timeout int `keyfile:"timeout"`
+		} `keyfile:"client"`
+	}
+
+	dec := NewDecoder(strings.NewReader(src))
+	dec.ReportAllErrors()
+	err := dec.Decode(&dst)
+
+	wantErrs := []error{
+		ErrKeyValuePairMustBeContainedInAGroup{Line: "orphan = 1", Position: Position{LineNumber: 1, Column: 1, Key: "orphan"}},
+		ErrInvalidEntry{Line: "host", Position: Position{LineNumber: 4, Column: 1, Group: "server"}},
+		ErrInvalidGroupName{Line: "[ ]", Position: Position{LineNumber: 6, Column: 1}},
+		ErrInvalidEscape{Line: `name = C:\Windows`, Sequence: `\W`, Position: Position{LineNumber: 5, Column: 10, Group: "server", Key: "name"}},
+	}
+	for _, want := range wantErrs {
+		if !errors.Is(err, want) {
+			t.Fatalf("%v does not contain %v", err, want)
+		}
+	}
+
+	errs := err.(interface{ Unwrap() []error }).Unwrap()
+	if len(errs) != 6 {
+		t.Fatalf("got %d errors: %v", len(errs), err)
+	}
+	lines := make([]int, 0)
+	for _, err := range errs {
+		var parseErr ErrCanNotParsed
+		if errors.As(err, &parseErr) {
+			lines = append(lines, parseErr.LineNumber)
+		}
+	}
+	if !reflect.DeepEqual(lines, []int{3, 10}) {
+		t.Fatalf("got conversion errors on lines %v", lines)
+	}
+
+	if dst.Client.Retries != 3 {
+		t.Fatalf("valid fields must be decoded, got %d", dst.Client.Retries)
+	}
+
+	// Read errors are reported with the syntax errors
+	errRead := errors.New("read failed")
+	dec = NewDecoder(io.MultiReader(strings.NewReader("[server]\nhost\n"), iotest.ErrReader(errRead)))
+	dec.ReportAllErrors()
+	err = dec.Decode(&dst)
+	if !errors.Is(err, errRead) || !errors.As(err, &ErrInvalidEntry{}) {
+		t.Fatalf("got %v, want the read error and ErrInvalidEntry", err)
+	}
+}
+
+func TestDecoderErrorPosition(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		dst  any
+		want Position
+	}{
+		{
+			name: "conversion error",
+			src:  "[server]\n  port = eighty\n",
+			dst: &struct {
+				Server struct {
+					Port int `keyfile:"port"`
+				} `keyfile:"server"`
+			}{},
+			want: Position{FileName: "app.conf", LineNumber: 2, Column: 10, Group: "server", Key: "port"},
+		},
+		{
+			name: "invalid escape in list element",
+			src:  "[server]\nhosts = a; b\\x;c\n",
+			dst: &struct {
+				Server struct {
+					Hosts []string `keyfile:"hosts"`
+				} `keyfile:"server"`
+			}{},
+			want: Position{FileName: "app.conf", LineNumber: 2, Column: 13, Group: "server", Key: "hosts"},
+		},
+		{
+			name: "localized value",
+			src:  "[server]\nname[de]=\\q\n",
+			dst: &struct {
+				Server struct {
+					Name LocaleString `keyfile:"name"`
+				} `keyfile:"server"`
+			}{},
+			want: Position{FileName: "app.conf", LineNumber: 2, Column: 10, Group: "server", Key: "name[de]"},
+		},
+		{
+			name: "missing required key",
+			src:  "[server]\n",
+			dst: &struct {
+				Server struct {
+					Port int `keyfile:"port,required"`
+				} `keyfile:"server"`
+			}{},
+			want: Position{FileName: "app.conf", Group: "server", Key: "port"},
+		},
+		{
+			name: "invalid group type",
+			src:  "[server]\n[name]\n",
+			dst: &struct {
+				Name string `keyfile:"name"`
+			}{},
+			want: Position{FileName: "app.conf", LineNumber: 2, Column: 1, Group: "name"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dec := NewDecoder(strings.NewReader(tt.src))
+			dec.SetFileName("app.conf")
+			err := dec.Decode(tt.dst)
+
+			var positioned interface{ Pos() Position }
+			if !errors.As(err, &positioned) {
+				t.Fatalf("got %v", err)
+			}
+			if got := positioned.Pos(); got != tt.want {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExcerpt(t *testing.T) {
+	src := "[server]\n\tport = eighty\n"
+	var dst struct {
+		Server struct {
+			Port int `keyfile:"port"`
+		} `keyfile:"server"`
+	}
+	dec := NewDecoder(strings.NewReader(src))
+	dec.SetFileName("app.conf")
+	err := dec.Decode(&dst)
+
+	want := `keyfile: app.conf:2:9: can not parsed: from "port" in group "server" to "Port int": strconv.ParseInt: parsing "eighty": invalid syntax
+    2 | 	port = eighty
+      | 	       ^
+`
+	if got := Excerpt(err, []byte(src)); got != want {
+		t.Fatalf("got\n%s\nwant\n%s", got, want)
+	}
+
+	// The caret counts characters, not bytes
+	src = "[server]\ngröße = eighty\n"
+	var sized struct {
+		Server struct {
+			Size int `keyfile:"größe"`
+		} `keyfile:"server"`
+	}
+	err = Unmarshal([]byte(src), &sized)
+	want = `keyfile: 2:11: can not parsed: from "größe" in group "server" to "Size int": strconv.ParseInt: parsing "eighty": invalid syntax
+    2 | größe = eighty
+      |         ^
+`
+	if got := Excerpt(err, []byte(src)); got != want {
+		t.Fatalf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestPositionString(t *testing.T) {
+	tests := []struct {
+		pos  Position
+		want string
+	}{
+		{pos: Position{FileName: "app.conf", LineNumber: 3, Column: 8}, want: "app.conf:3:8"},
+		{pos: Position{LineNumber: 3, Column: 8}, want: "3:8"},
+		{pos: Position{FileName: "app.conf", LineNumber: 3}, want: "app.conf:3"},
+		{pos: Position{FileName: "app.conf", Group: "server"}, want: "app.conf"},
+		{pos: Position{Group: "server", Key: "port"}, want: ""},
+	}
+	for _, tt := range tests {
+		if got := tt.pos.String(); got != tt.want {
+			t.Errorf("%+v: got %q, want %q", tt.pos, got, tt.want)
+		}
+	}
+
+	err := ErrKeyNotFound{Position: Position{Group: "server", Key: "port"}}
+	if want := `keyfile: key not found: "port" in group "server"`; err.Error() != want {
+		t.Fatalf("got %q, want %q", err.Error(), want)
+	}
+	err2 := ErrInvalidGroupType{GroupName: "Name", GroupType: "string", Position: Position{FileName: "app.conf", LineNumber: 2, Column: 1}}
+	if want := "keyfile: app.conf:2:1: invalid group type: Name string"; err2.Error() != want {
+		t.Fatalf("got %q, want %q", err2.Error(), want)
+	}
+}
+
+func TestDecoderDefaults(t *testing.T) {
+	type config struct {
+		Server struct {
+			Host  string       `keyfile:"host" default:"localhost"`
+			Port  int          `keyfile:"port" default:"8080"`
+			Tags  []string     `keyfile:"tags;sep:," default:"a,b\\,c"`
+			Name  LocaleString `keyfile:"name" default:"\\sServer"`
+			Debug bool         `keyfile:"debug"`
+		} `keyfile:"server"`
+		Client *struct {
+			Retries int `keyfile:"retries" default:"3"`
+		} `keyfile:"client"`
+	}
+
+	tests := []struct {
+		name string
+		src  string
+		want func(c *config)
+	}{
+		{
+			name: "missing group",
+			src:  "",
+			want: func(c *config) {
+				c.Server.Host = "localhost"
+				c.Server.Port = 8080
+				c.Server.Tags = []string{"a", "b,c"}
+				c.Server.Name = LocaleString{"": " Server"}
+			},
+		},
+		{
+			name: "present keys win",
+			src:  "[server]\nhost=\nport=80\nname[de]=Dienst\n[client]\n",
+			want: func(c *config) {
+				c.Server.Host = ""
+				c.Server.Port = 80
+				c.Server.Tags = []string{"a", "b,c"}
+				c.Server.Name = LocaleString{"": " Server", "de": "Dienst"}
+				c.Client = &struct {
+					Retries int `keyfile:"retries" default:"3"`
+				}{Retries: 3}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got, want config
+			err := Unmarshal([]byte(tt.src), &got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.want(&want)
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("got %+v, want %+v", got, want)
+			}
+		})
+	}
+
+	var dst struct {
+		Server struct {
+			Port int `keyfile:"port" default:"eighty"`
+		} `keyfile:"server"`
+	}
+	err := Unmarshal([]byte("[server]\n"), &dst)
+	want := Position{Group: "server", Key: "port"}
+	var parseErr ErrCanNotParsed
+	if !errors.As(err, &parseErr) || parseErr.Position != want {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestDecoderFlagNames(t *testing.T) {
+	type config struct {
+		Group struct {
+			Required string `keyfile:"required"`
+			Wildcard string `keyfile:"wildcard"`
+			Inline   struct {
+				Key string `keyfile:"key"`
+			} `keyfile:"inline"`
+		} `keyfile:"group"`
+	}
+
+	var dst config
+	err := Unmarshal([]byte("[group]\nrequired=a\nwildcard=b\ninline.key=c\n"), &dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dst.Group.Required != "a" || dst.Group.Wildcard != "b" || dst.Group.Inline.Key != "c" {
+		t.Fatalf("got %+v", dst.Group)
+	}
+}
+
+func TestDecoderRequired(t *testing.T) {
+	type config struct {
+		Server struct {
+			Host string `keyfile:"host,required"`
+			Port int    `keyfile:"port,omitempty,required"`
+			Name string `keyfile:"name"`
+		} `keyfile:"server"`
+		Database *struct {
+			URL string `keyfile:"url,required"`
+		} `keyfile:"database,required"`
+		Cache *struct {
+			Size int `keyfile:"size,required"`
+		} `keyfile:"cache"`
+		Optional struct {
+			Size int `keyfile:"size,required"`
+		} `keyfile:"optional"`
+	}
+
+	tests := []struct {
+		name string
+		src  string
+		errs []error
+	}{
+		{
+			name: "all present",
+			src:  "[server]\nhost=localhost\nport=80\n[database]\nurl=db\n",
+		},
+		{
+			name: "missing key of a present optional group",
+			src:  "[server]\nhost=localhost\nport=80\n[database]\nurl=db\n[optional]\n",
+			errs: []error{
+				ErrMissingRequired{Position: Position{Group: "optional", Key: "size"}},
+			},
+		},
+		{
+			name: "missing entries",
+			src:  "[server]\nport=80\nname=\n",
+			errs: []error{
+				ErrMissingRequired{Position: Position{Group: "server", Key: "host"}},
+				ErrMissingRequired{Position: Position{Group: "database"}},
+			},
+		},
+		{
+			name: "missing key of a present group",
+			src:  "[server]\nhost=localhost\nport=80\n[database]\n[cache]\n",
+			errs: []error{
+				ErrMissingRequired{Position: Position{Group: "database", Key: "url"}},
+				ErrMissingRequired{Position: Position{Group: "cache", Key: "size"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var dst config
+			err := Unmarshal([]byte(tt.src), &dst)
+			if len(tt.errs) == 0 && err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.errs {
+				if !errors.Is(err, want) {
+					t.Fatalf("%v does not contain %v", err, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,274 @@
+package keyfile
+
+import (
+	"bytes"
+	"cmp"
+	"io"
+	"strings"
+)
+
+// Dialect describes the syntax of a flavor of keyfile. The zero value is the
+// syntax of GLib key files, which is the default of the Decoder, the Encoder
+// and ParseDocument.
+type Dialect struct {
+	// CommentChars are the characters that start a comment line, "#" if
+	// empty. New comments are written with the first one.
+	CommentChars string
+	// ColonAssignment makes ":" separate a key from its value, like "=".
+	// Whichever comes first in the line is used.
+	ColonAssignment bool
+	// InlineComments makes a comment character that follows a blank end the
+	// value, like in "key=value ; comment".
+	InlineComments bool
+	// QuotedValues makes the double quotes around a value part of the syntax
+	// instead of the value, so that the value can keep comment characters.
+	// A double quote in the value is escaped as \".
+	QuotedValues bool
+	// LiteralBackslashes makes a backslash an ordinary character, so that a
+	// value like C:\dir is read as it is. Values are not escaped then, so
+	// they can not hold line breaks, and list elements can not hold the
+	// list separator.
+	LiteralBackslashes bool
+	// Continuation sets whether a backslash at the end of a line continues
+	// the value on the next line.
+	Continuation LineContinuation
+	// BareKeys allows a line with only a key, like "bare" in git-config,
+	// which has the value true.
+	BareKeys bool
+	// CaseInsensitive makes group and key names match regardless of case,
+	// except for the quoted subsection of a group like [remote "Origin"].
+	CaseInsensitive bool
+	// Duplicates sets the meaning of a key that is defined more than once in
+	// a group.
+	Duplicates DuplicateKeys
+	// ListSeparator separates the elements of lists, ";" if empty. The sep
+	// option of a field takes precedence. A blank separator allows any number
+	// of blanks between elements.
+	ListSeparator string
+	// RootKeys allows keys before the first group, see
+	// Decoder.AllowRootKeys.
+	RootKeys bool
+}
+
+// DuplicateKeys is the meaning of a key that is defined more than once.
+type DuplicateKeys int
+
+const (
+	// LastKeyWins uses the last definition of the key, like GLib.
+	LastKeyWins DuplicateKeys = iota
+	// FirstKeyWins uses the first definition of the key.
+	FirstKeyWins
+	// RejectDuplicateKeys makes a repeated key an ErrDuplicateKey.
+	RejectDuplicateKeys
+	// AppendDuplicateKeys decodes every definition of the key into a list
+	// field, like the multi-valued keys of systemd units and git-config. An
+	// empty value clears the elements defined before it. Every definition is
+	// a list, or one element if the field has the lines option, like
+	// `keyfile:"ExecStart,lines"`. Other fields use the last definition.
+	AppendDuplicateKeys
+)
+
+// LineContinuation is the meaning of a backslash at the end of a line.
+type LineContinuation int
+
+const (
+	// NoLineContinuation ends every entry at the end of its line, like GLib.
+	NoLineContinuation LineContinuation = iota
+	// JoinLines removes the backslash and the line ending, so that the next
+	// line continues the value, like in git-config.
+	JoinLines
+	// JoinLinesWithSpace replaces the backslash and the line ending with a
+	// space, like in systemd units.
+	JoinLinesWithSpace
+)
+
+var (
+	// GLibDialect is the strict syntax of GLib key files and desktop entries.
+	GLibDialect = Dialect{
+		CommentChars:  "#",
+		ListSeparator: ";",
+	}
+
+	// INIDialect is the common syntax of INI files, as read by Python's
+	// configparser or PHP: ";" and "#" comments, ":" assignments, quoted
+	// values, literal backslashes, case insensitive names, "," separated
+	// lists and keys before the first section.
+	INIDialect = Dialect{
+		CommentChars:       ";#",
+		ColonAssignment:    true,
+		InlineComments:     true,
+		QuotedValues:       true,
+		LiteralBackslashes: true,
+		CaseInsensitive:    true,
+		ListSeparator:      ",",
+		RootKeys:           true,
+	}
+
+	// SystemdDialect is the syntax of systemd unit files: "#" and ";"
+	// comments, blank separated lists, continued lines and keys like
+	// ExecStart that are repeated to add elements.
+	SystemdDialect = Dialect{
+		CommentChars:  "#;",
+		Continuation:  JoinLinesWithSpace,
+		Duplicates:    AppendDuplicateKeys,
+		ListSeparator: " ",
+	}
+
+	// GitConfigDialect is the syntax of git-config files: "#" and ";"
+	// comments, also at the end of a line, quoted values, continued lines,
+	// keys without a value, case insensitive names and multi-valued keys.
+	// Subsections like [remote "origin"] are decoded like other subgroups.
+	GitConfigDialect = Dialect{
+		CommentChars:    "#;",
+		InlineComments:  true,
+		QuotedValues:    true,
+		Continuation:    JoinLines,
+		BareKeys:        true,
+		CaseInsensitive: true,
+		Duplicates:      AppendDuplicateKeys,
+	}
+)
+
+// ParseDocument parses data written in the dialect.
+func (d Dialect) ParseDocument(data []byte) (*Document, error) {
+	return d.ReadDocument(bytes.NewReader(data))
+}
+
+// ReadDocument reads a document written in the dialect.
+func (d Dialect) ReadDocument(r io.Reader) (*Document, error) {
+	p := newParser(r)
+	p.doc.dialect = d
+	err := p.parse()
+	if err != nil {
+		return nil, err
+	}
+	return p.doc, nil
+}
+
+func (d Dialect) commentChars() string {
+	return cmp.Or(d.CommentChars, "#")
+}
+
+func (d Dialect) listSeparator() string {
+	return cmp.Or(d.ListSeparator, ";")
+}
+
+func (d Dialect) isComment(line string) bool {
+	return line != "" && strings.ContainsRune(d.commentChars(), rune(line[0]))
+}
+
+// assignment returns the index of the character that separates the key from
+// the value in the line, or -1.
+func (d Dialect) assignment(line string) int {
+	if d.ColonAssignment {
+		return strings.IndexAny(line, "=:")
+	}
+	return strings.Index(line, "=")
+}
+
+// valueEnd returns the end of the value at the beginning of raw, before an
+// inline comment and the blanks in front of it. raw follows the blanks after
+// the assignment, so a comment character at its start is a comment too.
+func (d Dialect) valueEnd(raw string) int {
+	end := len(raw)
+	quoted := false
+scan:
+	for i := 0; i < len(raw) && d.InlineComments; i++ {
+		switch {
+		case raw[i] == '\\' && !d.LiteralBackslashes:
+			i++
+		case raw[i] == '"' && d.QuotedValues:
+			quoted = !quoted
+		case !quoted && (i == 0 || isBlank(raw[i-1])) && strings.IndexByte(d.commentChars(), raw[i]) >= 0:
+			end = i
+			break scan
+		}
+	}
+	return len(strings.TrimRight(raw[:end], " \t"))
+}
+
+// needsQuotes reports whether an escaped value must be quoted to be read
+// back in the dialect.
+func (d Dialect) needsQuotes(value string) bool {
+	if !d.QuotedValues {
+		return false
+	}
+	if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+		return true
+	}
+	// Blanks around the value can not be escaped as \s
+	if d.LiteralBackslashes && value != trimBlank(value) {
+		return true
+	}
+	return d.InlineComments && strings.ContainsAny(value, d.commentChars())
+}
+
+// quote returns an escaped value in double quotes, escaping the double quotes
+// in it.
+func (d Dialect) quote(value string) string {
+	if d.LiteralBackslashes {
+		return `"` + value + `"`
+	}
+	return `"` + strings.ReplaceAll(value, `"`, `\"`) + `"`
+}
+
+// escape escapes a value, unless backslashes are literal.
+func (d Dialect) escape(value string) string {
+	if d.LiteralBackslashes {
+		return value
+	}
+	return escape(value)
+}
+
+// continues reports whether a line ends with a backslash that continues it
+// on the next line. An escaped backslash or one in a comment does not.
+func (d Dialect) continues(line string) bool {
+	if d.Continuation == NoLineContinuation || d.isComment(strings.TrimSpace(line)) {
+		return false
+	}
+	rest := strings.TrimLeft(line[d.assignment(line)+1:], " \t")
+	value := rest[:d.valueEnd(rest)]
+	if len(value) != len(rest) {
+		return false
+	}
+	n := len(value) - len(strings.TrimRight(value, "\\"))
+	return n%2 == 1
+}
+
+// joinLines joins the lines of a continued value.
+func (d Dialect) joinLines(value string) string {
+	sep := ""
+	if d.Continuation == JoinLinesWithSpace {
+		sep = " "
+	}
+	return strings.NewReplacer("\\\r\n", sep, "\\\n", sep).Replace(value)
+}
+
+func (d Dialect) equal(a, b string) bool {
+	if d.CaseInsensitive {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
+
+// fold returns the name in the form that is compared by the dialect.
+func (d Dialect) fold(name string) string {
+	if d.CaseInsensitive {
+		return strings.ToLower(name)
+	}
+	return name
+}
+
+// foldGroup is fold for the name of a group. A quoted subsection keeps its
+// case, like in git.
+func (d Dialect) foldGroup(name string) string {
+	section, subsection, ok := strings.Cut(name, ` "`)
+	if !ok || !strings.HasSuffix(subsection, `"`) {
+		return d.fold(name)
+	}
+	return d.fold(section) + ` "` + subsection
+}
+
+func (d Dialect) equalGroup(a, b string) bool {
+	return d.foldGroup(a) == d.foldGroup(b)
+}
@@ -0,0 +1,473 @@
+package keyfile
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecoderDialect(t *testing.T) {
+	type section struct {
+		Name  string   `keyfile:"name"`
+		Path  string   `keyfile:"path"`
+		Items []string `keyfile:"items"`
+		Exec  []string `keyfile:"exec,lines"`
+		Bare  bool     `keyfile:"bare"`
+	}
+	type config struct {
+		Section section `keyfile:"Section"`
+	}
+
+	tests := []struct {
+		name    string
+		dialect Dialect
+		src     string
+		want    section
+		err     any // pointer to the type of the expected error
+	}{
+		{
+			name:    "glib",
+			dialect: GLibDialect,
+			src:     "[Section]\nname=a ; b\nitems=x;y\nname=c\n",
+			want:    section{Name: "c", Items: []string{"x", "y"}},
+		},
+		{
+			name:    "glib semicolon comment",
+			dialect: GLibDialect,
+			src:     "[Section]\n; comment\n",
+			err:     &ErrInvalidEntry{},
+		},
+		{
+			name:    "ini",
+			dialect: INIDialect,
+			src:     "; comment\n[section]\nNAME: a ; comment\npath = \"C:\\dir ; x\" # comment\nitems = x, y\n",
+			want:    section{Name: "a", Path: "C:\\dir ; x", Items: []string{"x", "y"}},
+		},
+		{
+			name:    "ini literal backslashes",
+			dialect: INIDialect,
+			src:     "[section]\npath=C:\\dir\\\nitems=a\\,b\n",
+			want:    section{Path: "C:\\dir\\", Items: []string{"a\\", "b"}},
+		},
+		{
+			name:    "systemd",
+			dialect: SystemdDialect,
+			src:     "[Section]\n; comment\nitems=a  b\nitems=c\nname=a # not a comment\n",
+			want:    section{Name: "a # not a comment", Items: []string{"a", "b", "c"}},
+		},
+		{
+			name:    "systemd reset list",
+			dialect: SystemdDialect,
+			src:     "[Section]\nitems=a b\nitems=\nitems=c\n",
+			want:    section{Items: []string{"c"}},
+		},
+		{
+			name:    "systemd lines",
+			dialect: SystemdDialect,
+			src:     "[Section]\nexec=/bin/foo -a\nitems=a b\nexec=/bin/bar\nitems=c\n",
+			want:    section{Items: []string{"a", "b", "c"}, Exec: []string{"/bin/foo -a", "/bin/bar"}},
+		},
+		{
+			name:    "systemd continued lines",
+			dialect: SystemdDialect,
+			src:     "[Section]\nexec=/bin/foo \\\n\t-a\\\r\n-b\nitems=a\\\nb\nname=a\\\\\n",
+			want:    section{Name: "a\\", Items: []string{"a", "b"}, Exec: []string{"/bin/foo  \t-a -b"}},
+		},
+		{
+			name:    "gitconfig",
+			dialect: GitConfigDialect,
+			src:     "[section]\n\tName = \"a;b\" ; comment\n\titems = x\n\tITEMS = y\n",
+			want:    section{Name: "a;b", Items: []string{"x", "y"}},
+		},
+		{
+			name:    "gitconfig bare key and escaped quotes",
+			dialect: GitConfigDialect,
+			src:     "[section]\n\tbare ; comment\n\tname = \"say \\\"hi\\\" ; x\"\n",
+			want:    section{Name: `say "hi" ; x`, Bare: true},
+		},
+		{
+			name:    "gitconfig continued lines",
+			dialect: GitConfigDialect,
+			src:     "[section]\n\tname = \"a ;\\\nb\" ; comment \\\n\titems = x\\\ny\n",
+			want:    section{Name: "a ;b", Items: []string{"xy"}},
+		},
+		{
+			name:    "escaped quotes need quoted values",
+			dialect: GLibDialect,
+			src:     "[Section]\nname=say \\\"hi\\\"\n",
+			err:     &ErrInvalidEscape{},
+		},
+		{
+			name:    "bare keys need the dialect",
+			dialect: INIDialect,
+			src:     "[section]\nbare\n",
+			err:     &ErrInvalidEntry{},
+		},
+		{
+			name:    "first key wins",
+			dialect: Dialect{Duplicates: FirstKeyWins},
+			src:     "[Section]\nname=a\n[Section]\nname=b\n",
+			want:    section{Name: "a"},
+		},
+		{
+			name:    "reject duplicate keys",
+			dialect: Dialect{Duplicates: RejectDuplicateKeys},
+			src:     "[Section]\nname=a\n[Section]\nname=b\n",
+			err:     &ErrDuplicateKey{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var dst config
+			dec := NewDecoder(strings.NewReader(tt.src))
+			dec.SetDialect(tt.dialect)
+			err := dec.Decode(&dst)
+			if tt.err != nil {
+				if !errors.As(err, tt.err) {
+					t.Fatalf("got %v, want %T", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(dst.Section, tt.want) {
+				t.Fatalf("got %+v, want %+v", dst.Section, tt.want)
+			}
+		})
+	}
+}
+
+func TestDialectSubgroups(t *testing.T) {
+	type remote struct {
+		URL string `keyfile:"url"`
+	}
+	var dst struct {
+		Remotes map[string]remote `keyfile:"remote"`
+	}
+
+	src := "[Remote \"Origin\"]\n\turl = git@example.com:repo.git\n[remote \"origin\"]\n\turl = git@example.com:fork.git\n"
+	dec := NewDecoder(strings.NewReader(src))
+	dec.SetDialect(GitConfigDialect)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Subsections are case sensitive, unlike sections
+	want := map[string]remote{"Origin": {URL: "git@example.com:repo.git"}, "origin": {URL: "git@example.com:fork.git"}}
+	if !reflect.DeepEqual(dst.Remotes, want) {
+		t.Fatalf("got %v, want %v", dst.Remotes, want)
+	}
+}
+
+func TestEncoderDialect(t *testing.T) {
+	type section struct {
+		Name  string   `keyfile:"name" comment:"the name"`
+		Items []string `keyfile:"items"`
+	}
+	src := struct {
+		Section section `keyfile:"section"`
+	}{section{Name: "a ; b", Items: []string{"x", "y"}}}
+
+	var buf strings.Builder
+	enc := NewEncoder(&buf)
+	enc.SetDialect(INIDialect)
+	err := enc.Encode(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "[section]\nitems=x,y\n; the name\nname=\"a ; b\"\n"
+	if buf.String() != want {
+		t.Fatalf("got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestEncoderLines(t *testing.T) {
+	type service struct {
+		ExecStart []string `keyfile:"ExecStart,lines"`
+		After     []string `keyfile:"After"`
+	}
+	type unit struct {
+		Service service `keyfile:"Service"`
+	}
+
+	src := unit{service{ExecStart: []string{"/bin/foo -a", "/bin/bar"}, After: []string{"a", "b"}}}
+	var buf strings.Builder
+	enc := NewEncoder(&buf)
+	enc.SetDialect(SystemdDialect)
+	err := enc.Encode(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "[Service]\nAfter=a b\nExecStart=/bin/foo -a\nExecStart=/bin/bar\n"
+	if buf.String() != want {
+		t.Fatalf("got %q, want %q", buf.String(), want)
+	}
+
+	var dst unit
+	dec := NewDecoder(strings.NewReader(want))
+	dec.SetDialect(SystemdDialect)
+	err = dec.Decode(&dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(dst, src) {
+		t.Fatalf("got %+v, want %+v", dst, src)
+	}
+
+	// Existing definitions are updated in place
+	doc, err := SystemdDialect.ParseDocument([]byte("[Service]\nExecStart=/bin/old\n# keep\nExecStart=/bin/old2\nExecStart=/bin/old3\nUser=nobody\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	enc = NewEncoder(&buf)
+	enc.SetDialect(SystemdDialect)
+	enc.SetDocument(doc)
+	err = enc.Encode(unit{service{ExecStart: []string{"/bin/new"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = "[Service]\nExecStart=/bin/new\n# keep\nUser=nobody\nAfter=\n"
+	if buf.String() != want {
+		t.Fatalf("got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestGitConfigDocument(t *testing.T) {
+	src := "[core]\n\tbare ; comment\n[remote \"Origin\"]\n\turl = x\n"
+	doc, err := GitConfigDialect.ParseDocument([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.String() != src {
+		t.Fatalf("got %q, want %q", doc.String(), src)
+	}
+	if v, err := doc.GetBoolean("CORE", "bare"); err != nil || !v {
+		t.Fatalf("bare: %v %v", v, err)
+	}
+	if doc.HasKey(`remote "origin"`, "url") || !doc.HasKey(`REMOTE "Origin"`, "URL") {
+		t.Fatal("subsection is not case sensitive")
+	}
+
+	doc.SetBoolean("core", "bare", false)
+	doc.SetString(`remote "Origin"`, "url", "y")
+	want := "[core]\n\tbare=false ; comment\n[remote \"Origin\"]\n\turl = y\n"
+	if doc.String() != want {
+		t.Fatalf("got %q, want %q", doc.String(), want)
+	}
+
+	doc.SetString("core", "editor", "vim")
+	err = doc.RemoveKey("core", "Editor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.String() != want {
+		t.Fatalf("got %q, want %q", doc.String(), want)
+	}
+
+	// Double quotes in quoted values are escaped
+	type section struct {
+		Name string `keyfile:"name"`
+	}
+	type config struct {
+		Section section `keyfile:"section"`
+	}
+	var buf strings.Builder
+	enc := NewEncoder(&buf)
+	enc.SetDialect(GitConfigDialect)
+	err = enc.Encode(config{section{Name: `x" ; y`}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantData := "[section]\nname=\"x\\\" ; y\"\n"
+	if buf.String() != wantData {
+		t.Fatalf("got %q, want %q", buf.String(), wantData)
+	}
+	var dst config
+	dec := NewDecoder(strings.NewReader(buf.String()))
+	dec.SetDialect(GitConfigDialect)
+	err = dec.Decode(&dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dst.Section.Name != `x" ; y` {
+		t.Fatalf("got %q", dst.Section.Name)
+	}
+}
+
+func TestDocumentDialect(t *testing.T) {
+	src := "; top\n\n[Section]\nkey = \"old\" ; keep\nother: 1 # keep\n"
+	doc, err := INIDialect.ParseDocument([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.String() != src {
+		t.Fatalf("got %q, want %q", doc.String(), src)
+	}
+
+	comment, err := doc.GetComment("", "")
+	if err != nil || comment != "top" {
+		t.Fatalf("got %q, %v, want %q", comment, err, "top")
+	}
+
+	doc.SetString("section", "KEY", "new")
+	doc.SetInteger("SECTION", "other", 2)
+	want := "; top\n\n[Section]\nkey = \"new\" ; keep\nother: 2 # keep\n"
+	if doc.String() != want {
+		t.Fatalf("got %q, want %q", doc.String(), want)
+	}
+
+	err = doc.RemoveKey("section", "OTHER")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = "; top\n\n[Section]\nkey = \"new\" ; keep\n"
+	if doc.String() != want {
+		t.Fatalf("got %q, want %q", doc.String(), want)
+	}
+
+	// Omitted keys are removed whatever their case
+	doc, err = INIDialect.ParseDocument([]byte("[Entry]\nICON=x\nName=a\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	type entry struct {
+		Name string `keyfile:"Name"`
+		Icon string `keyfile:"Icon,omitempty"`
+	}
+	var buf strings.Builder
+	enc := NewEncoder(&buf)
+	enc.SetDialect(INIDialect)
+	enc.SetDocument(doc)
+	err = enc.Encode(struct {
+		Entry entry `keyfile:"Entry"`
+	}{entry{Name: "a"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = "[Entry]\nName=a\n"
+	if buf.String() != want {
+		t.Fatalf("got %q, want %q", buf.String(), want)
+	}
+
+	// Values are written in the dialect of the document
+	doc, err = INIDialect.ParseDocument([]byte("[Entry]\nl=x\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	type list struct {
+		Entry struct {
+			L []string `keyfile:"l"`
+		} `keyfile:"Entry"`
+	}
+	var value list
+	value.Entry.L = []string{"a", "b"}
+	buf.Reset()
+	enc = NewEncoder(&buf)
+	enc.SetDocument(doc)
+	err = enc.Encode(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = "[Entry]\nl=a,b\n"
+	if buf.String() != want {
+		t.Fatalf("got %q, want %q", buf.String(), want)
+	}
+	var dst list
+	dec := NewDecoder(strings.NewReader(buf.String()))
+	dec.SetDialect(INIDialect)
+	err = dec.Decode(&dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(dst, value) {
+		t.Fatalf("got %+v, want %+v", dst, value)
+	}
+}
+
+func TestLineContinuation(t *testing.T) {
+	src := "[Service]\nExecStart=/bin/foo \\\n  -a\nUser=nobody\n"
+	doc, err := SystemdDialect.ParseDocument([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.String() != src {
+		t.Fatalf("got %q, want %q", doc.String(), src)
+	}
+	if v, err := doc.GetString("Service", "ExecStart"); err != nil || v != "/bin/foo    -a" {
+		t.Fatalf("got %q, %v", v, err)
+	}
+	if node := doc.Group("Service").Entry("User", ""); node.LineNumber() != 4 {
+		t.Fatalf("got line %d, want 4", node.LineNumber())
+	}
+
+	doc.SetString("Service", "ExecStart", "/bin/bar")
+	want := "[Service]\nExecStart=/bin/bar\nUser=nobody\n"
+	if doc.String() != want {
+		t.Fatalf("got %q, want %q", doc.String(), want)
+	}
+
+	// Errors after continued lines have the line of the source
+	_, err = SystemdDialect.ParseDocument([]byte(src + "bad\n"))
+	var entryErr ErrInvalidEntry
+	if !errors.As(err, &entryErr) || entryErr.LineNumber != 5 {
+		t.Fatalf("got %v", err)
+	}
+
+	// Without continuation, the next line is an entry of its own
+	_, err = ParseDocument([]byte(src))
+	if !errors.As(err, &entryErr) || entryErr.LineNumber != 3 {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestLiteralBackslashes(t *testing.T) {
+	type section struct {
+		Path  string   `keyfile:"path"`
+		Pad   string   `keyfile:"pad"`
+		Items []string `keyfile:"items"`
+	}
+	type config struct {
+		Section section `keyfile:"section"`
+	}
+
+	src := config{section{Path: `C:\dir`, Pad: " x ", Items: []string{`a\`, "b"}}}
+	var buf strings.Builder
+	enc := NewEncoder(&buf)
+	enc.SetDialect(INIDialect)
+	err := enc.Encode(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "[section]\nitems=a\\,b\npad=\" x \"\npath=C:\\dir\n"
+	if buf.String() != want {
+		t.Fatalf("got %q, want %q", buf.String(), want)
+	}
+
+	var dst config
+	dec := NewDecoder(strings.NewReader(buf.String()))
+	dec.SetDialect(INIDialect)
+	err = dec.Decode(&dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(dst, src) {
+		t.Fatalf("got %+v, want %+v", dst, src)
+	}
+
+	doc, err := INIDialect.ParseDocument([]byte(want))
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc.SetString("section", "path", `D:\dir`)
+	if v, err := doc.GetString("section", "path"); err != nil || v != `D:\dir` {
+		t.Fatalf("got %q, %v", v, err)
+	}
+	if v, err := doc.GetStringList("section", "items"); err != nil || !reflect.DeepEqual(v, []string{`a\`, "b"}) {
+		t.Fatalf("got %q, %v", v, err)
+	}
+}
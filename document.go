@@ -0,0 +1,732 @@
+package keyfile
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Document is a lossless representation of a keyfile. Comments, blank lines,
+// the order of groups and keys and the original formatting are kept, so a
+// parsed document is written back byte-for-byte identical where it was not
+// modified.
+//
+// Lines before the first group header belong to the root group, which has an
+// empty name and no header.
+type Document struct {
+	groups  []*Group
+	eol     string
+	dialect Dialect
+}
+
+// Group is a group of a Document with the nodes that follow its header.
+type Group struct {
+	doc    *Document
+	name   string
+	header *Node
+	nodes  []*Node
+}
+
+type NodeKind int
+
+const (
+	BlankNode NodeKind = iota
+	CommentNode
+	GroupNode
+	EntryNode
+)
+
+// Node is a single line of a Document, with the lines that continue it in
+// dialects with line continuation.
+type Node struct {
+	kind       NodeKind
+	raw        string
+	eol        string
+	lineNumber int
+
+	// group header
+	name string
+
+	// entry
+	key         string
+	locale      string
+	value       string
+	valueOffset int
+	valueEnd    int
+	quoted      bool
+	bare        bool
+}
+
+var mapValueRgx = regexp.MustCompile(`(.*)\[(.*)\]`)
+
+func NewDocument() *Document {
+	doc := &Document{eol: "\n"}
+	doc.groups = []*Group{{doc: doc}}
+	return doc
+}
+
+// ParseDocument parses data in the GLib dialect. See Dialect.ParseDocument
+// for other dialects.
+func ParseDocument(data []byte) (*Document, error) {
+	return ReadDocument(bytes.NewReader(data))
+}
+
+func ReadDocument(r io.Reader) (*Document, error) {
+	p := newParser(r)
+	err := p.parse()
+	if err != nil {
+		return nil, err
+	}
+	return p.doc, nil
+}
+
+type parser struct {
+	r          *bufio.Reader
+	doc        *Document
+	fileName   string
+	lineNumber int
+	eolSeen    bool
+
+	// keys holds the keys seen in every group to find duplicates
+	keys map[string]bool
+
+	// allErrors makes the parser skip invalid lines and report all of their
+	// errors at the end instead of stopping at the first one.
+	allErrors bool
+	errs      []error
+}
+
+func newParser(r io.Reader) *parser {
+	return &parser{
+		r:    bufio.NewReader(r),
+		doc:  NewDocument(),
+		keys: make(map[string]bool),
+	}
+}
+
+func (p *parser) parse() error {
+	group := p.doc.groups[0]
+	for {
+		// Read line
+		lineRaw, err := p.r.ReadString('\n')
+		if err != nil && err != io.EOF {
+			err = fmt.Errorf("read line: %w", err)
+			if !p.allErrors {
+				return err
+			}
+			// Report the lines read so far with the error
+			p.errs = append(p.errs, err)
+			break
+		}
+		p.lineNumber++
+
+		// The end of the file
+		if err == io.EOF && lineRaw == "" {
+			break
+		}
+
+		node := &Node{lineNumber: p.lineNumber}
+		node.raw, node.eol = cutLineEnding(lineRaw)
+		if node.eol != "" && !p.eolSeen {
+			p.doc.eol = node.eol
+			p.eolSeen = true
+		}
+		err = p.continueLine(node)
+		if err != nil {
+			if !p.allErrors {
+				return err
+			}
+			p.errs = append(p.errs, err)
+			break
+		}
+
+		err = p.parseNode(node, group.name)
+		if err != nil {
+			if !p.allErrors {
+				return err
+			}
+			p.errs = append(p.errs, err)
+			if node.kind == GroupNode {
+				// Drop the entries of an invalid group
+				group = &Group{doc: p.doc, header: node}
+			}
+			continue
+		}
+
+		switch node.kind {
+		case GroupNode:
+			group = &Group{doc: p.doc, name: node.name, header: node}
+			p.doc.groups = append(p.doc.groups, group)
+		case EntryNode:
+			err = p.checkEntry(node, group)
+			if err != nil {
+				if !p.allErrors {
+					return err
+				}
+				p.errs = append(p.errs, err)
+				continue
+			}
+			group.nodes = append(group.nodes, node)
+		default:
+			group.nodes = append(group.nodes, node)
+		}
+	}
+
+	return errors.Join(p.errs...)
+}
+
+// checkEntry returns an error if the entry is not allowed in the group by the
+// dialect: before the first group, or as a duplicate of a key.
+func (p *parser) checkEntry(node *Node, group *Group) error {
+	if group.header == nil && !p.doc.dialect.RootKeys {
+		return ErrKeyValuePairMustBeContainedInAGroup{
+			Line:     node.line(),
+			Position: node.position(p.fileName, group.name),
+		}
+	}
+
+	if p.doc.dialect.Duplicates != RejectDuplicateKeys {
+		return nil
+	}
+	key := p.doc.dialect.foldGroup(group.name) + "\x00" + p.doc.dialect.fold(node.fullKey())
+	if p.keys[key] {
+		return ErrDuplicateKey{Line: node.line(), Position: node.position(p.fileName, group.name)}
+	}
+	p.keys[key] = true
+	return nil
+}
+
+// continueLine appends the lines that continue the line of the node to it,
+// with the line endings between them.
+func (p *parser) continueLine(node *Node) error {
+	for node.eol != "" && p.doc.dialect.continues(node.raw) {
+		lineRaw, err := p.r.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("read line: %w", err)
+		}
+		if lineRaw == "" {
+			return nil
+		}
+		p.lineNumber++
+		next, eol := cutLineEnding(lineRaw)
+		node.raw += node.eol + next
+		node.eol = eol
+	}
+	return nil
+}
+
+func cutLineEnding(line string) (string, string) {
+	if strings.HasSuffix(line, "\r\n") {
+		return line[:len(line)-2], "\r\n"
+	}
+	if strings.HasSuffix(line, "\n") {
+		return line[:len(line)-1], "\n"
+	}
+	return line, ""
+}
+
+func (p *parser) parseNode(node *Node, groupName string) error {
+	line := strings.TrimSpace(node.raw)
+	pos := node.position(p.fileName, groupName)
+
+	// Empty line
+	if line == "" {
+		node.kind = BlankNode
+		return nil
+	}
+
+	// Comment
+	if p.doc.dialect.isComment(line) {
+		node.kind = CommentNode
+		return nil
+	}
+
+	// Group header
+	if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+		node.kind = GroupNode
+		node.name = strings.TrimSpace(strings.Trim(line, "[]"))
+		if node.name == "" {
+			pos.Group = ""
+			return ErrInvalidGroupName{Line: line, Position: pos}
+		}
+		return nil
+	}
+
+	// Key-value pair
+	eq := p.doc.dialect.assignment(node.raw)
+	if eq == -1 {
+		if p.doc.dialect.BareKeys && parseBareKey(node, p.doc.dialect) {
+			return nil
+		}
+		return ErrInvalidEntry{Line: line, Position: pos}
+	}
+
+	key := strings.TrimSpace(node.raw[:eq])
+	locale := ""
+	if sm := mapValueRgx.FindStringSubmatch(key); len(sm) == 3 {
+		key = sm[1]
+		locale = sm[2]
+	}
+
+	if key == "" {
+		return ErrInvalidKey{Line: line, Position: pos}
+	}
+
+	node.kind = EntryNode
+	node.key = key
+	node.locale = locale
+	node.valueOffset = eq + 1
+	for node.valueOffset < len(node.raw) && isBlank(node.raw[node.valueOffset]) {
+		node.valueOffset++
+	}
+	node.valueEnd = node.valueOffset + p.doc.dialect.valueEnd(node.raw[node.valueOffset:])
+	node.value = node.raw[node.valueOffset:node.valueEnd]
+
+	// The quotes are kept in the line when the value is set
+	if p.doc.dialect.QuotedValues && len(node.value) >= 2 && node.value[0] == '"' && node.value[len(node.value)-1] == '"' {
+		node.valueOffset++
+		node.valueEnd--
+		node.value = node.raw[node.valueOffset:node.valueEnd]
+		node.quoted = true
+	}
+	node.value = p.doc.dialect.joinLines(node.value)
+
+	return nil
+}
+
+// parseBareKey parses a line with only a key, which has the value true. It
+// reports whether the line is a key.
+func parseBareKey(node *Node, dialect Dialect) bool {
+	start := len(node.raw) - len(strings.TrimLeft(node.raw, " \t"))
+	end := start + dialect.valueEnd(node.raw[start:])
+	key := node.raw[start:end]
+	if key == "" || strings.ContainsAny(key, " \t") {
+		return false
+	}
+
+	node.kind = EntryNode
+	node.key = key
+	node.value = "true"
+	node.valueOffset = end
+	node.valueEnd = end
+	node.bare = true
+	return true
+}
+
+func isBlank(c byte) bool {
+	return c == ' ' || c == '\t'
+}
+
+// Bytes returns the encoded document.
+func (doc *Document) Bytes() []byte {
+	var buf bytes.Buffer
+	_, _ = doc.WriteTo(&buf)
+	return buf.Bytes()
+}
+
+func (doc *Document) String() string {
+	return string(doc.Bytes())
+}
+
+func (doc *Document) WriteTo(w io.Writer) (int64, error) {
+	var total int64
+	for _, group := range doc.groups {
+		for _, node := range group.allNodes() {
+			n, err := io.WriteString(w, node.raw+node.eol)
+			total += int64(n)
+			if err != nil {
+				return total, err
+			}
+		}
+	}
+	return total, nil
+}
+
+// Groups returns the groups of the document in source order. The root group
+// is not included.
+func (doc *Document) Groups() []*Group {
+	return doc.groups[1:]
+}
+
+// Root returns the group holding the lines before the first group header.
+func (doc *Document) Root() *Group {
+	return doc.groups[0]
+}
+
+// Group returns the first group with the given name, or nil.
+func (doc *Document) Group(name string) *Group {
+	for _, group := range doc.groups[1:] {
+		if doc.dialect.equalGroup(group.name, name) {
+			return group
+		}
+	}
+	return nil
+}
+
+// AddGroup appends a new group to the end of the document.
+func (doc *Document) AddGroup(name string) *Group {
+	if last := doc.lastNode(); last != nil && last.kind != BlankNode {
+		doc.groups[len(doc.groups)-1].append(&Node{kind: BlankNode})
+	}
+	group := &Group{
+		doc:    doc,
+		name:   name,
+		header: &Node{kind: GroupNode, name: name, raw: fmt.Sprintf("[%s]", name)},
+	}
+	doc.terminateLastNode()
+	group.header.eol = doc.eol
+	doc.groups = append(doc.groups, group)
+	return group
+}
+
+// Remove removes the group and all of its nodes from the document.
+func (g *Group) Remove() {
+	doc := g.doc
+	for i := 1; i < len(doc.groups); i++ {
+		if doc.groups[i] == g {
+			doc.groups = append(doc.groups[:i], doc.groups[i+1:]...)
+			return
+		}
+	}
+}
+
+// groupsNamed returns every group with the given name. Groups may be repeated
+// in a file, in which case their entries are merged. The root group is named
+// by the empty string.
+func (doc *Document) groupsNamed(name string) []*Group {
+	groups := make([]*Group, 0, 1)
+	for _, group := range doc.groups {
+		if doc.dialect.equalGroup(group.name, name) {
+			groups = append(groups, group)
+		}
+	}
+	return groups
+}
+
+func (doc *Document) hasGroup(name string) bool {
+	return len(doc.groupsNamed(name)) > 0
+}
+
+// lookup returns the entry that defines the value of key[locale] in the group.
+// Later entries override earlier ones, unless the first one wins in the
+// dialect.
+func (doc *Document) lookup(groupName, key, locale string) *Node {
+	var found *Node
+	for _, node := range doc.entries(groupName, key) {
+		if node.locale != locale {
+			continue
+		}
+		if found != nil && doc.dialect.Duplicates == FirstKeyWins {
+			break
+		}
+		found = node
+	}
+	return found
+}
+
+// set updates the entry that defines key[locale] in the group, or appends a
+// new entry to the last group with that name. The group is created if it does
+// not exist.
+func (doc *Document) set(groupName, key, locale, value string) *Node {
+	if node := doc.lookup(groupName, key, locale); node != nil {
+		node.SetValue(value)
+		return node
+	}
+	return doc.lastGroup(groupName).SetEntry(key, locale, value)
+}
+
+// appendEntry adds a definition of key after its last one, or to the last
+// group with the given name if the key is not defined, for keys that are
+// repeated to add elements to a list.
+func (doc *Document) appendEntry(groupName, key, value string) *Node {
+	groups := doc.groupsNamed(groupName)
+	for i := len(groups) - 1; i >= 0; i-- {
+		for j := len(groups[i].nodes) - 1; j >= 0; j-- {
+			node := groups[i].nodes[j]
+			if node.kind == EntryNode && node.locale == "" && doc.dialect.equal(node.key, key) {
+				entry := &Node{kind: EntryNode, key: key}
+				entry.SetValue(value)
+				groups[i].insert(j+1, entry)
+				return entry
+			}
+		}
+	}
+	return doc.lastGroup(groupName).SetEntry(key, "", value)
+}
+
+// lastGroup returns the last group with the given name, adding it to the end
+// of the document if it does not exist.
+func (doc *Document) lastGroup(name string) *Group {
+	groups := doc.groupsNamed(name)
+	if len(groups) == 0 {
+		return doc.AddGroup(name)
+	}
+	return groups[len(groups)-1]
+}
+
+// locales returns the entries of key for every locale defined in the group.
+// The untranslated value has an empty locale.
+func (doc *Document) locales(groupName, key string) map[string]*Node {
+	result := make(map[string]*Node)
+	for _, node := range doc.entries(groupName, key) {
+		result[node.locale] = node
+	}
+	return result
+}
+
+// entries returns every entry of key in the group, including locale variants.
+func (doc *Document) entries(groupName, key string) []*Node {
+	result := make([]*Node, 0)
+	for _, group := range doc.groupsNamed(groupName) {
+		for _, node := range group.nodes {
+			if node.kind == EntryNode && doc.dialect.equal(node.key, key) {
+				result = append(result, node)
+			}
+		}
+	}
+	return result
+}
+
+func (doc *Document) lastNode() *Node {
+	for i := len(doc.groups) - 1; i >= 0; i-- {
+		if nodes := doc.groups[i].allNodes(); len(nodes) > 0 {
+			return nodes[len(nodes)-1]
+		}
+	}
+	return nil
+}
+
+// terminateLastNode makes sure the document ends with a line ending before
+// anything is appended to it.
+func (doc *Document) terminateLastNode() {
+	if last := doc.lastNode(); last != nil && last.eol == "" {
+		last.eol = doc.eol
+	}
+}
+
+func (g *Group) Name() string {
+	return g.name
+}
+
+// Header returns the node of the group header, or nil for the root group.
+func (g *Group) Header() *Node {
+	return g.header
+}
+
+// Nodes returns the nodes following the group header in source order.
+func (g *Group) Nodes() []*Node {
+	return g.nodes
+}
+
+// Entry returns the last entry with the given key and locale, or nil.
+func (g *Group) Entry(key, locale string) *Node {
+	for i := len(g.nodes) - 1; i >= 0; i-- {
+		node := g.nodes[i]
+		if node.kind == EntryNode && g.doc.dialect.equal(node.key, key) && node.locale == locale {
+			return node
+		}
+	}
+	return nil
+}
+
+// SetEntry updates the raw value of key[locale], or appends a new entry after
+// the last entry of the group if it does not exist.
+func (g *Group) SetEntry(key, locale, value string) *Node {
+	if node := g.Entry(key, locale); node != nil {
+		node.SetValue(value)
+		return node
+	}
+
+	node := &Node{kind: EntryNode, key: key, locale: locale}
+	node.SetValue(value)
+
+	// Keys of the root group go below the comment at the top of the file and
+	// are kept apart from the first group and its comment
+	if g.header == nil {
+		for i := len(g.nodes) - 1; i >= 0; i-- {
+			if g.nodes[i].kind == EntryNode {
+				g.insert(i+1, node)
+				return node
+			}
+		}
+
+		_, _, end, _ := g.doc.commentRange("", "")
+		if end > 0 {
+			end++
+		}
+		g.insert(end, node)
+		if len(g.doc.groups) > 1 {
+			g.insert(end+1, &Node{kind: BlankNode})
+		}
+		return node
+	}
+
+	g.insert(g.lastEntryIndex()+1, node)
+	return node
+}
+
+// AddComment appends a comment line to the group. The text is written after
+// a "# " prefix.
+func (g *Group) AddComment(text string) *Node {
+	node := g.doc.newCommentNode(text)
+	g.insert(g.lastEntryIndex()+1, node)
+	return node
+}
+
+// RemoveNode removes the node from the group.
+func (g *Group) RemoveNode(node *Node) {
+	for i := range g.nodes {
+		if g.nodes[i] == node {
+			g.nodes = append(g.nodes[:i], g.nodes[i+1:]...)
+			return
+		}
+	}
+}
+
+func (g *Group) allNodes() []*Node {
+	if g.header == nil {
+		return g.nodes
+	}
+	return append([]*Node{g.header}, g.nodes...)
+}
+
+// lastEntryIndex returns the index of the last entry or comment of the group,
+// so that trailing blank lines stay at the end of the group.
+func (g *Group) lastEntryIndex() int {
+	for i := len(g.nodes) - 1; i >= 0; i-- {
+		if g.nodes[i].kind != BlankNode {
+			return i
+		}
+	}
+	return -1
+}
+
+func (g *Group) append(node *Node) {
+	g.insert(len(g.nodes), node)
+}
+
+func (g *Group) insert(i int, node *Node) {
+	if i == len(g.nodes) && g.doc.groups[len(g.doc.groups)-1] == g {
+		g.doc.terminateLastNode()
+	}
+	node.eol = g.doc.eol
+	if i > 0 && g.nodes[i-1].eol == "" {
+		g.nodes[i-1].eol = node.eol
+	}
+	g.nodes = append(g.nodes[:i], append([]*Node{node}, g.nodes[i:]...)...)
+}
+
+// newCommentNode returns a comment line that starts with the first comment
+// character of the dialect.
+func (doc *Document) newCommentNode(text string) *Node {
+	raw := doc.dialect.commentChars()[:1]
+	if text != "" {
+		raw += " " + text
+	}
+	return &Node{kind: CommentNode, raw: raw}
+}
+
+func (n *Node) Kind() NodeKind {
+	return n.kind
+}
+
+// LineNumber returns the line of the node in the parsed source, or 0 if the
+// node was added afterwards.
+func (n *Node) LineNumber() int {
+	return n.lineNumber
+}
+
+// Raw returns the text of the line without its line ending. The lines that
+// continue it are included with their line endings.
+func (n *Node) Raw() string {
+	return n.raw
+}
+
+// Name returns the name of a group header.
+func (n *Node) Name() string {
+	return n.name
+}
+
+func (n *Node) Key() string {
+	return n.key
+}
+
+// position returns the position of the node in the source. The column points
+// to the first character of the line that is not blank.
+func (n *Node) position(fileName, groupName string) Position {
+	return Position{
+		FileName:   fileName,
+		LineNumber: n.lineNumber,
+		Column:     len(n.raw) - len(strings.TrimLeft(n.raw, " \t")) + 1,
+		Group:      groupName,
+		Key:        n.fullKey(),
+	}
+}
+
+// valuePosition returns the position of the value of an entry.
+func (n *Node) valuePosition(fileName, groupName string) Position {
+	pos := n.position(fileName, groupName)
+	pos.Column = n.valueOffset + 1
+	return pos
+}
+
+// line returns the text of the line without surrounding whitespace.
+func (n *Node) line() string {
+	return strings.TrimSpace(n.raw)
+}
+
+// fullKey returns the key with its locale in the key[locale] form.
+func (n *Node) fullKey() string {
+	if n.locale == "" {
+		return n.key
+	}
+	return fmt.Sprintf("%s[%s]", n.key, n.locale)
+}
+
+func (n *Node) Locale() string {
+	return n.locale
+}
+
+// Value returns the raw, still escaped value of an entry. A bare key has the
+// value true.
+func (n *Node) Value() string {
+	return n.value
+}
+
+// Comment returns the text of a comment line without the leading comment
+// character, like "#", and the single space following it.
+func (n *Node) Comment() string {
+	if n.kind != CommentNode {
+		return ""
+	}
+	text := strings.TrimSpace(n.raw)
+	return strings.TrimPrefix(text[1:], " ")
+}
+
+// SetValue replaces the raw value of an entry. The key, the spacing around
+// the "=", the quotes and the inline comment are kept as they were in the
+// source.
+func (n *Node) SetValue(value string) {
+	if n.kind != EntryNode || (n.value == value && n.raw != "") {
+		return
+	}
+	if n.raw == "" {
+		n.raw = n.fullKey() + "="
+		n.valueOffset = len(n.raw)
+		n.valueEnd = len(n.raw)
+	}
+	// A bare key gets an assignment in front of its value
+	if n.bare {
+		n.raw = n.raw[:n.valueOffset] + "=" + n.raw[n.valueOffset:]
+		n.valueOffset++
+		n.valueEnd = n.valueOffset
+		n.bare = false
+	}
+	n.raw = n.raw[:n.valueOffset] + value + n.raw[n.valueEnd:]
+	n.value = value
+	n.valueEnd = n.valueOffset + len(value)
+}
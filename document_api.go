@@ -0,0 +1,314 @@
+package keyfile
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// The methods below mirror the GKeyFile API of GLib. Values are looked up by
+// group and key name; when a group or key is repeated in the file, the last
+// definition wins.
+
+// GetGroups returns the names of all groups in source order.
+func (doc *Document) GetGroups() []string {
+	groups := make([]string, 0, len(doc.groups)-1)
+	for _, group := range doc.groups[1:] {
+		if !slices.ContainsFunc(groups, func(name string) bool { return doc.dialect.equalGroup(name, group.name) }) {
+			groups = append(groups, group.name)
+		}
+	}
+	return groups
+}
+
+func (doc *Document) HasGroup(group string) bool {
+	return doc.hasGroup(group)
+}
+
+// GetKeys returns the names of all keys of the group in source order. Locale
+// variants of a key are not listed separately.
+func (doc *Document) GetKeys(group string) ([]string, error) {
+	groups := doc.groupsNamed(group)
+	if len(groups) == 0 {
+		return nil, ErrGroupNotFound{Position: Position{Group: group}}
+	}
+
+	keys := make([]string, 0)
+	for _, g := range groups {
+		for _, node := range g.nodes {
+			if node.kind == EntryNode && !slices.ContainsFunc(keys, func(key string) bool { return doc.dialect.equal(key, node.key) }) {
+				keys = append(keys, node.key)
+			}
+		}
+	}
+	return keys, nil
+}
+
+func (doc *Document) HasKey(group, key string) bool {
+	return doc.lookup(group, key, "") != nil
+}
+
+// GetValue returns the raw value of the key without unescaping it.
+func (doc *Document) GetValue(group, key string) (string, error) {
+	node, err := doc.entry(group, key)
+	if err != nil {
+		return "", err
+	}
+	return node.value, nil
+}
+
+// SetValue sets the raw value of the key. The group and the key are created
+// if they do not exist.
+func (doc *Document) SetValue(group, key, value string) {
+	doc.set(group, key, "", value)
+}
+
+func (doc *Document) GetString(group, key string) (string, error) {
+	node, err := doc.entry(group, key)
+	if err != nil {
+		return "", err
+	}
+	return unescapeAt(node.value, "", doc.dialect, node.valuePosition("", group), node.line())
+}
+
+func (doc *Document) SetString(group, key, value string) {
+	doc.SetValue(group, key, doc.dialect.escape(value))
+}
+
+// GetBoolean returns the value of the key as a boolean in GoBoolSyntax, like
+// the Decoder does by default.
+func (doc *Document) GetBoolean(group, key string) (bool, error) {
+	node, err := doc.entry(group, key)
+	if err != nil {
+		return false, err
+	}
+	v, err := parseBool(node.value, GoBoolSyntax)
+	if err != nil {
+		return false, ErrInvalidValue{Err: err, Position: node.valuePosition("", group)}
+	}
+	return v, nil
+}
+
+func (doc *Document) SetBoolean(group, key string, value bool) {
+	doc.SetValue(group, key, strconv.FormatBool(value))
+}
+
+func (doc *Document) GetInteger(group, key string) (int, error) {
+	node, err := doc.entry(group, key)
+	if err != nil {
+		return 0, err
+	}
+	v, err := strconv.Atoi(node.value)
+	if err != nil {
+		return 0, ErrInvalidValue{Err: err, Position: node.valuePosition("", group)}
+	}
+	return v, nil
+}
+
+func (doc *Document) SetInteger(group, key string, value int) {
+	doc.SetValue(group, key, strconv.Itoa(value))
+}
+
+func (doc *Document) GetDouble(group, key string) (float64, error) {
+	node, err := doc.entry(group, key)
+	if err != nil {
+		return 0, err
+	}
+	v, err := strconv.ParseFloat(node.value, 64)
+	if err != nil {
+		return 0, ErrInvalidValue{Err: err, Position: node.valuePosition("", group)}
+	}
+	return v, nil
+}
+
+func (doc *Document) SetDouble(group, key string, value float64) {
+	doc.SetValue(group, key, strconv.FormatFloat(value, 'f', -1, 64))
+}
+
+// GetStringList returns the elements of a list separated by the list
+// separator of the dialect, a semicolon by default.
+func (doc *Document) GetStringList(group, key string) ([]string, error) {
+	node, err := doc.entry(group, key)
+	if err != nil {
+		return nil, err
+	}
+	sep := doc.dialect.listSeparator()
+	elems := splitList(node.value, sep, doc.dialect.LiteralBackslashes)
+	pos := node.valuePosition("", group)
+	for i := range elems {
+		elemPos := pos
+		elemPos.Column += len(elems[i]) - len(strings.TrimLeft(elems[i], " \t"))
+		pos.Column += len(elems[i]) + len(sep)
+		elems[i], err = unescapeAt(trimBlank(elems[i]), sep, doc.dialect, elemPos, node.line())
+		if err != nil {
+			return nil, err
+		}
+	}
+	return elems, nil
+}
+
+func (doc *Document) SetStringList(group, key string, list []string) {
+	elems := make([]string, len(list))
+	for i := range list {
+		elems[i] = doc.dialect.escape(list[i])
+	}
+	doc.SetValue(group, key, joinList(elems, doc.dialect.listSeparator(), doc.dialect.LiteralBackslashes))
+}
+
+// RemoveGroup removes every group with the given name.
+func (doc *Document) RemoveGroup(group string) error {
+	groups := doc.groupsNamed(group)
+	if len(groups) == 0 {
+		return ErrGroupNotFound{Position: Position{Group: group}}
+	}
+	for _, g := range groups {
+		g.Remove()
+	}
+	return nil
+}
+
+// RemoveKey removes the key and all of its locale variants from the group,
+// together with the comments above them.
+func (doc *Document) RemoveKey(group, key string) error {
+	if _, err := doc.entry(group, key); err != nil {
+		return err
+	}
+	doc.removeKey(group, key)
+	return nil
+}
+
+func (doc *Document) removeKey(group, key string) {
+	for _, g := range doc.groupsNamed(group) {
+		for i := len(g.nodes) - 1; i >= 0; i-- {
+			node := g.nodes[i]
+			if node.kind != EntryNode || !doc.dialect.equal(node.key, key) {
+				continue
+			}
+			start := commentStart(g.nodes, i)
+			g.nodes = append(g.nodes[:start], g.nodes[i+1:]...)
+			i = start
+		}
+	}
+}
+
+// GetComment returns the comment above the key. If key is empty, the comment
+// above the group is returned, and if group is empty too, the comment at the
+// top of the file.
+//
+// The top comment is the block of comment lines at the beginning of the file
+// that is followed by a blank line. Comment lines directly above a group
+// header belong to the group.
+func (doc *Document) GetComment(group, key string) (string, error) {
+	nodes, start, end, err := doc.commentRange(group, key)
+	if err != nil {
+		return "", err
+	}
+	lines := make([]string, 0, end-start)
+	for _, node := range nodes[start:end] {
+		lines = append(lines, node.Comment())
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// SetComment replaces the comment above the key, the group or the top of the
+// file, following the rules of GetComment. Every line of the comment is
+// written with a "# " prefix. An empty comment removes the existing one.
+func (doc *Document) SetComment(group, key, comment string) error {
+	_, start, end, err := doc.commentRange(group, key)
+	if err != nil {
+		return err
+	}
+
+	owner := doc.commentOwner(group, key)
+	nodes := make([]*Node, 0)
+	if comment != "" {
+		for _, line := range strings.Split(comment, "\n") {
+			nodes = append(nodes, doc.newCommentNode(line))
+		}
+		if group == "" && end == start {
+			nodes = append(nodes, &Node{kind: BlankNode})
+		}
+	}
+
+	owner.nodes = append(owner.nodes[:start], owner.nodes[end:]...)
+	for i, node := range nodes {
+		owner.insert(start+i, node)
+	}
+	if group == "" && comment == "" && start < len(owner.nodes) && end > start && owner.nodes[start].kind == BlankNode {
+		owner.nodes = append(owner.nodes[:start], owner.nodes[start+1:]...)
+	}
+	return nil
+}
+
+func (doc *Document) RemoveComment(group, key string) error {
+	return doc.SetComment(group, key, "")
+}
+
+func (doc *Document) entry(group, key string) (*Node, error) {
+	if !doc.hasGroup(group) {
+		return nil, ErrGroupNotFound{Position: Position{Group: group}}
+	}
+	node := doc.lookup(group, key, "")
+	if node == nil {
+		return nil, ErrKeyNotFound{Position: Position{Group: group, Key: key}}
+	}
+	return node, nil
+}
+
+// commentOwner returns the group whose nodes hold the comment of the key, the
+// group or the top of the file.
+func (doc *Document) commentOwner(group, key string) *Group {
+	if group == "" {
+		return doc.groups[0]
+	}
+	if key != "" {
+		for _, g := range doc.groupsNamed(group) {
+			if g.Entry(key, "") == doc.lookup(group, key, "") {
+				return g
+			}
+		}
+	}
+	i := slices.Index(doc.groups, doc.Group(group))
+	return doc.groups[i-1]
+}
+
+// commentRange returns the nodes holding the comment and its bounds.
+func (doc *Document) commentRange(group, key string) ([]*Node, int, int, error) {
+	if group == "" {
+		nodes := doc.groups[0].nodes
+		end := 0
+		for end < len(nodes) && nodes[end].kind == CommentNode {
+			end++
+		}
+		if end == len(nodes) || nodes[end].kind != BlankNode {
+			return nodes, 0, 0, nil
+		}
+		return nodes, 0, end, nil
+	}
+
+	if key != "" {
+		node, err := doc.entry(group, key)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		nodes := doc.commentOwner(group, key).nodes
+		end := slices.Index(nodes, node)
+		return nodes, commentStart(nodes, end), end, nil
+	}
+
+	if !doc.hasGroup(group) {
+		return nil, 0, 0, ErrGroupNotFound{Position: Position{Group: group}}
+	}
+	nodes := doc.commentOwner(group, key).nodes
+	return nodes, commentStart(nodes, len(nodes)), len(nodes), nil
+}
+
+// commentStart returns the index of the first line of the comment block that
+// ends right before nodes[end].
+func commentStart(nodes []*Node, end int) int {
+	start := end
+	for start > 0 && nodes[start-1].kind == CommentNode {
+		start--
+	}
+	return start
+}
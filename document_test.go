@@ -0,0 +1,308 @@
+package keyfile
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestDocumentRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		err  error
+	}{
+		{
+			name: "empty",
+			src:  ``,
+		},
+		{
+			name: "comments and blank lines",
+			src:  "# header comment\n\n[Desktop Entry]\n# name of the app\nName = Example\n\n\n  Exec=example %U\n\n[Other]\nkey=value\n",
+		},
+		{
+			name: "crlf line endings",
+			src:  "[group]\r\nkey=value\r\n\r\n# comment\r\n",
+		},
+		{
+			name: "no trailing newline",
+			src:  "[group]\nkey=value",
+		},
+		{
+			name: "locales and escapes",
+			src:  "[group]\nName=Hello\nName[de] =  Hallo\t\nPath=\\s\\tvalue\\n\n",
+		},
+		{
+			name: "repeated group",
+			src:  "[a]\nkey=1\n[b]\nkey=2\n[a]\nkey=3\n",
+		},
+		{
+			name: "invalid group name",
+			src:  "[ ]\n",
+			err:  ErrInvalidGroupName{Line: "[ ]", Position: Position{LineNumber: 1, Column: 1}},
+		},
+		{
+			name: "invalid entry",
+			src:  "[group]\nkey\n",
+			err:  ErrInvalidEntry{Line: "key", Position: Position{LineNumber: 2, Column: 1, Group: "group"}},
+		},
+		{
+			name: "entry outside of a group",
+			src:  "key=value\n",
+			err:  ErrKeyValuePairMustBeContainedInAGroup{Line: "key=value", Position: Position{LineNumber: 1, Column: 1, Key: "key"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := ParseDocument([]byte(tt.src))
+			if !errors.Is(err, tt.err) {
+				t.Fatal(err)
+			}
+			if err != nil {
+				return
+			}
+			if got := doc.String(); got != tt.src {
+				t.Fatalf("got %q, want %q", got, tt.src)
+			}
+		})
+	}
+}
+
+func TestDocumentEdit(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		edit func(doc *Document)
+		want string
+	}{
+		{
+			name: "update value keeps formatting",
+			src:  "# comment\n[group]\nkey1 = old # not a comment\nkey2=value\n",
+			edit: func(doc *Document) {
+				doc.Group("group").SetEntry("key1", "", "new")
+			},
+			want: "# comment\n[group]\nkey1 = new\nkey2=value\n",
+		},
+		{
+			name: "add entry before trailing blank lines",
+			src:  "[a]\nkey1=value\n\n[b]\n",
+			edit: func(doc *Document) {
+				doc.Group("a").SetEntry("key2", "de", "wert")
+			},
+			want: "[a]\nkey1=value\nkey2[de]=wert\n\n[b]\n",
+		},
+		{
+			name: "add group without trailing newline",
+			src:  "[a]\nkey=value",
+			edit: func(doc *Document) {
+				doc.AddGroup("b").SetEntry("key", "", "value")
+			},
+			want: "[a]\nkey=value\n\n[b]\nkey=value\n",
+		},
+		{
+			name: "add group keeps crlf",
+			src:  "[a]\r\nkey=value\r\n",
+			edit: func(doc *Document) {
+				doc.AddGroup("b").AddComment("comment")
+			},
+			want: "[a]\r\nkey=value\r\n\r\n[b]\r\n# comment\r\n",
+		},
+		{
+			name: "remove group and node",
+			src:  "[a]\nkey1=1\nkey2=2\n[b]\nkey=value\n",
+			edit: func(doc *Document) {
+				group := doc.Group("a")
+				group.RemoveNode(group.Entry("key1", ""))
+				doc.Group("b").Remove()
+			},
+			want: "[a]\nkey2=2\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := ParseDocument([]byte(tt.src))
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.edit(doc)
+			if got := doc.String(); got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDocumentGetters(t *testing.T) {
+	src := `# top comment
+
+[group]
+string = \sHello\tWorld
+bool = true
+int = 42
+double = 42.5
+list = a;b; c
+invalid = foo
+
+[group]
+int = 43
+
+[other]
+`
+	doc, err := ParseDocument([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := doc.GetGroups(); !reflect.DeepEqual(got, []string{"group", "other"}) {
+		t.Fatalf("groups: %v", got)
+	}
+	keys, err := doc.GetKeys("group")
+	if err != nil || !reflect.DeepEqual(keys, []string{"string", "bool", "int", "double", "list", "invalid"}) {
+		t.Fatalf("keys: %v %v", keys, err)
+	}
+	if !doc.HasKey("group", "bool") || doc.HasKey("group", "missing") || doc.HasKey("other", "bool") {
+		t.Fatal("has key")
+	}
+
+	if v, err := doc.GetString("group", "string"); err != nil || v != " Hello\tWorld" {
+		t.Fatalf("string: %q %v", v, err)
+	}
+	if v, err := doc.GetBoolean("group", "bool"); err != nil || !v {
+		t.Fatalf("bool: %v %v", v, err)
+	}
+	if v, err := doc.GetInteger("group", "int"); err != nil || v != 43 {
+		t.Fatalf("int: %v %v", v, err)
+	}
+	if v, err := doc.GetDouble("group", "double"); err != nil || v != 42.5 {
+		t.Fatalf("double: %v %v", v, err)
+	}
+	if v, err := doc.GetStringList("group", "list"); err != nil || !reflect.DeepEqual(v, []string{"a", "b", "c"}) {
+		t.Fatalf("list: %q %v", v, err)
+	}
+
+	if _, err := doc.GetString("missing", "key"); !errors.Is(err, ErrGroupNotFound{Position: Position{Group: "missing"}}) {
+		t.Fatal(err)
+	}
+	if _, err := doc.GetString("group", "missing"); !errors.Is(err, ErrKeyNotFound{Position: Position{Group: "group", Key: "missing"}}) {
+		t.Fatal(err)
+	}
+	var invalidValue ErrInvalidValue
+	if _, err := doc.GetInteger("group", "invalid"); !errors.As(err, &invalidValue) || invalidValue.Key != "invalid" {
+		t.Fatal(err)
+	}
+	if _, err := doc.GetBoolean("group", "invalid"); !errors.As(err, &invalidValue) || invalidValue.Key != "invalid" {
+		t.Fatal(err)
+	}
+}
+
+func TestDocumentSetters(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		edit func(doc *Document) error
+		want string
+	}{
+		{
+			name: "set values",
+			src:  "[group]\nint = 1\n",
+			edit: func(doc *Document) error {
+				doc.SetInteger("group", "int", 2)
+				doc.SetBoolean("group", "bool", false)
+				doc.SetDouble("other", "double", 1.5)
+				doc.SetString("other", "string", " a\nb")
+				doc.SetStringList("other", "list", []string{"a", "b"})
+				return nil
+			},
+			want: "[group]\nint = 2\nbool=false\n\n[other]\ndouble=1.5\nstring=\\sa\\nb\nlist=a;b\n",
+		},
+		{
+			name: "remove key with locales and comment",
+			src:  "[group]\n# name\nName=a\nName[de]=b\nkey=c\n",
+			edit: func(doc *Document) error {
+				return doc.RemoveKey("group", "Name")
+			},
+			want: "[group]\nkey=c\n",
+		},
+		{
+			name: "remove group",
+			src:  "[a]\nkey=1\n[b]\nkey=2\n[a]\nkey=3\n",
+			edit: func(doc *Document) error {
+				return doc.RemoveGroup("a")
+			},
+			want: "[b]\nkey=2\n",
+		},
+		{
+			name: "set comments",
+			src:  "# old group comment\n[group]\n# old key comment\nkey=value\n",
+			edit: func(doc *Document) error {
+				if err := doc.SetComment("", "", "top"); err != nil {
+					return err
+				}
+				if err := doc.SetComment("group", "", "group\ncomment"); err != nil {
+					return err
+				}
+				return doc.SetComment("group", "key", "")
+			},
+			want: "# top\n\n# group\n# comment\n[group]\nkey=value\n",
+		},
+		{
+			name: "set root keys",
+			src:  "# top\n\n# group\n[group]\nkey=value\n",
+			edit: func(doc *Document) error {
+				doc.SetString("", "a", "1")
+				doc.SetString("", "b", "2")
+				return nil
+			},
+			want: "# top\n\na=1\nb=2\n\n# group\n[group]\nkey=value\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := ParseDocument([]byte(tt.src))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.edit(doc); err != nil {
+				t.Fatal(err)
+			}
+			if got := doc.String(); got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDocumentComments(t *testing.T) {
+	src := "# top\n# comment\n\n# about group\n[group]\n#about key\nkey=value\nother=value\n"
+	doc, err := ParseDocument([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		group string
+		key   string
+		want  string
+		err   error
+	}{
+		{group: "", key: "", want: "top\ncomment"},
+		{group: "group", key: "", want: "about group"},
+		{group: "group", key: "key", want: "about key"},
+		{group: "group", key: "other", want: ""},
+		{group: "group", key: "missing", err: ErrKeyNotFound{Position: Position{Group: "group", Key: "missing"}}},
+		{group: "missing", key: "", err: ErrGroupNotFound{Position: Position{Group: "missing"}}},
+	}
+
+	for _, tt := range tests {
+		got, err := doc.GetComment(tt.group, tt.key)
+		if !errors.Is(err, tt.err) {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Fatalf("%s/%s: got %q, want %q", tt.group, tt.key, got, tt.want)
+		}
+	}
+}
@@ -3,31 +3,126 @@ package keyfile
 import (
 	"bufio"
 	"cmp"
+	"encoding"
 	"errors"
-	"fmt"
 	"io"
+	"maps"
 	"reflect"
-	"sort"
+	"slices"
 	"strconv"
-	"strings"
 )
 
 type Encoder struct {
 	w                *bufio.Writer
+	doc              *Document
+	order            Order
 	currentGroup     reflect.StructField
 	currentGroupName string
 	currentField     reflect.StructField
+	currentKeyName   string
 	writtenGroupName string
 	groups           map[string]map[string]map[string]string
+	groupOrder       []string
+	keyOrder         map[string][]string
+	fields           map[string]map[string]reflect.StructField
+	header           string
+	useDefaults      bool
+	dialect          Dialect
+	boolTrue         string
+	boolFalse        string
+	comments         map[string]map[string]string   // map[groupName]map[key]comment, key is empty for groups
+	omitted          map[string][]omittedKey        // keys left out by omitempty, removed from the document
+	slicePatterns    map[string]string              // map[groupName]pattern of the groups of slices, which keep their order
+	lines            map[string]map[string][]string // map[groupName]map[key]elements of fields with the lines option
 }
 
+// omittedKey is a key that is left out by omitempty, with the field and its
+// zero value, so that a zero value in the document is kept.
+type omittedKey struct {
+	key   string
+	field reflect.StructField
+	zero  string
+}
+
+// Order is the order in which the encoder writes groups and keys.
+type Order int
+
+const (
+	// SortedOrder writes groups and keys sorted by name. The groups of a
+	// slice keep the order of the slice.
+	SortedOrder Order = iota
+	// DeclarationOrder writes groups and keys in the order of the struct fields.
+	DeclarationOrder
+)
+
 func NewEncoder(w io.Writer) *Encoder {
 	return &Encoder{
-		w:      bufio.NewWriter(w),
-		groups: make(map[string]map[string]map[string]string),
+		w:             bufio.NewWriter(w),
+		groups:        make(map[string]map[string]map[string]string),
+		keyOrder:      make(map[string][]string),
+		fields:        make(map[string]map[string]reflect.StructField),
+		comments:      make(map[string]map[string]string),
+		omitted:       make(map[string][]omittedKey),
+		slicePatterns: make(map[string]string),
+		lines:         make(map[string]map[string][]string),
 	}
 }
 
+// SetOrder sets the order of new groups and keys. The default is SortedOrder.
+func (enc *Encoder) SetOrder(order Order) {
+	enc.order = order
+}
+
+// SetHeader sets a comment that is written at the top of the file.
+func (enc *Encoder) SetHeader(comment string) {
+	enc.header = comment
+}
+
+// SetBoolValues sets the words that are written for true and false, like
+// "yes" and "no". The default is "true" and "false".
+func (enc *Encoder) SetBoolValues(t, f string) {
+	enc.boolTrue = t
+	enc.boolFalse = f
+}
+
+// UseDefaults makes the encoder write the value of the default tag for fields
+// that hold their zero value, which is useful to generate a sample file from
+// an empty struct.
+func (enc *Encoder) UseDefaults() {
+	enc.useDefaults = true
+}
+
+// AllowRootKeys makes the encoder write the fields of the model that are not
+// groups as keys before the first group, the counterpart of
+// Decoder.AllowRootKeys.
+func (enc *Encoder) AllowRootKeys() {
+	enc.dialect.RootKeys = true
+}
+
+// SetDialect sets the syntax of the output, like INIDialect. The default is
+// GLibDialect. It replaces the options set by AllowRootKeys. A document set
+// with SetDocument is written in its own dialect.
+func (enc *Encoder) SetDialect(dialect Dialect) {
+	enc.dialect = dialect
+}
+
+// SetDocument makes the encoder write its values into doc, and then the whole
+// document to the writer. Groups and keys that already exist in doc keep
+// their position; new keys are appended to the end of their group and new
+// groups to the end of the document.
+func (enc *Encoder) SetDocument(doc *Document) {
+	enc.doc = doc
+}
+
+// syntax returns the dialect the values are written in, which is the one of
+// the document set with SetDocument.
+func (enc *Encoder) syntax() Dialect {
+	if enc.doc != nil {
+		return enc.doc.dialect
+	}
+	return enc.dialect
+}
+
 func (enc *Encoder) Encode(v any) error {
 	rv := reflect.ValueOf(v)
 
@@ -53,6 +148,9 @@ func (enc *Encoder) validateParameter(rv reflect.Value) error {
 	if rv.Kind() == reflect.Pointer {
 		return enc.validateParameter(rv.Elem())
 	}
+	if rv.Kind() == reflect.Map && rv.Type().Key().Kind() == reflect.String {
+		return nil
+	}
 	if rv.Kind() != reflect.Struct {
 		return ErrInvalidParameterType
 	}
@@ -64,21 +162,93 @@ func (enc *Encoder) scan(rv reflect.Value) error {
 		return enc.scan(rv.Elem())
 	}
 
+	if rv.Kind() == reflect.Map {
+		for _, key := range sortedMapKeys(rv) {
+			enc.currentGroup = reflect.StructField{Name: key.String(), Type: rv.Type().Elem()}
+			err := enc.addGroup(key.String(), rv.MapIndex(key))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
 	for i := range rv.NumField() {
 		field := rv.Field(i)
 		enc.currentGroup = rv.Type().Field(i)
 
 		// Skip unexported or ignored groups
-		if (!enc.currentGroup.IsExported() || isIgnored(enc.currentGroup.Tag)) ||
-			(isOmitempty(enc.currentGroup.Tag) && field.IsZero()) {
+		if !enc.currentGroup.IsExported() || isIgnored(enc.currentGroup.Tag) {
 			continue
 		}
 
-		enc.currentGroupName = cmp.Or(getKeyName(enc.currentGroup.Tag), enc.currentGroup.Name)
+		// The fields that are not groups are the keys of the root group
+		if enc.dialect.RootKeys && !isRoot(enc.currentGroup.Tag) && !isGroupType(enc.currentGroup.Type) {
+			enc.currentGroupName = ""
+			enc.currentField = enc.currentGroup
+			if _, ok := enc.groups[""]; !ok {
+				enc.groupOrder = append(enc.groupOrder, "")
+				enc.groups[""] = make(map[string]map[string]string)
+				enc.fields[""] = make(map[string]reflect.StructField)
+			}
+			err := enc.addKey(field, "")
+			if err != nil {
+				return err
+			}
+			continue
+		}
 
-		enc.groups[enc.currentGroupName] = make(map[string]map[string]string)
+		if isOmitempty(enc.currentGroup.Tag) && field.IsZero() {
+			continue
+		}
 
-		err := enc.scanGroup(field)
+		name := cmp.Or(getKeyName(enc.currentGroup.Tag), enc.currentGroup.Name)
+		if isRoot(enc.currentGroup.Tag) {
+			err := enc.addGroup("", field)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		// a map or a slice holds groups that match the name
+		if (field.Kind() == reflect.Map || field.Kind() == reflect.Slice) && !isGroupType(field.Type()) {
+			return ErrInvalidGroupType{
+				GroupName: enc.currentGroup.Name,
+				GroupType: enc.currentGroup.Type.String(),
+				Position:  Position{Group: name},
+			}
+		}
+		if field.Kind() == reflect.Map {
+			for _, key := range sortedMapKeys(field) {
+				err := enc.addGroup(groupName(name, key.String()), field.MapIndex(key))
+				if err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if field.Kind() == reflect.Slice {
+			for i := range field.Len() {
+				wildcard, ok := wildcardField(field.Index(i))
+				if !ok {
+					return ErrMissingWildcard{
+						GroupName: enc.currentGroup.Name,
+						GroupType: enc.currentGroup.Type.String(),
+						Position:  Position{Group: name},
+					}
+				}
+				group := groupName(name, wildcard.String())
+				enc.slicePatterns[group] = name
+				err := enc.addGroup(group, field.Index(i))
+				if err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		err := enc.addGroup(name, field)
 		if err != nil {
 			return err
 		}
@@ -87,8 +257,21 @@ func (enc *Encoder) scan(rv reflect.Value) error {
 	return nil
 }
 
+// addGroup adds a group with the keys of rv.
+func (enc *Encoder) addGroup(name string, rv reflect.Value) error {
+	enc.currentGroupName = name
+	if _, ok := enc.groups[name]; !ok {
+		enc.groupOrder = append(enc.groupOrder, name)
+	}
+	enc.groups[name] = make(map[string]map[string]string)
+	enc.fields[name] = make(map[string]reflect.StructField)
+	enc.setComment(name, "", enc.currentGroup.Tag)
+
+	return enc.scanGroup(rv)
+}
+
 func (enc *Encoder) scanGroup(rv reflect.Value) error {
-	if rv.Kind() == reflect.Pointer {
+	if rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface {
 		return enc.scanGroup(rv.Elem())
 	}
 
@@ -96,49 +279,166 @@ func (enc *Encoder) scanGroup(rv reflect.Value) error {
 		return nil
 	}
 
+	if rv.Kind() == reflect.Map && rv.Type().Key().Kind() == reflect.String {
+		return enc.scanGroupMap(rv)
+	}
+
 	if rv.Kind() != reflect.Struct {
-		return ErrInvalidGroupType{GroupName: enc.currentGroup.Name, GroupType: enc.currentGroup.Type.String()}
+		return ErrInvalidGroupType{
+			GroupName: enc.currentGroup.Name,
+			GroupType: enc.currentGroup.Type.String(),
+			Position:  Position{Group: enc.currentGroupName},
+		}
 	}
 
-	enc.currentGroupName = cmp.Or(getKeyName(enc.currentGroup.Tag), enc.currentGroup.Name)
+	return enc.scanFields(rv, "")
+}
 
+// scanFields scans the fields of a group, or of a struct nested in it whose
+// keys start with prefix.
+func (enc *Encoder) scanFields(rv reflect.Value, prefix string) error {
 	for i := range rv.NumField() {
 		field := rv.Field(i)
 		enc.currentField = rv.Type().Field(i)
 
-		// Skip unexported or ignored groups
-		if !enc.currentField.IsExported() || isIgnored(enc.currentField.Tag) ||
-			(isOmitempty(enc.currentField.Tag) && field.IsZero()) {
+		// Embedded and inline structs share the keys of the group
+		if isInline(enc.currentField) {
+			if field.Kind() == reflect.Pointer && field.IsNil() {
+				continue
+			}
+			err := enc.scanFields(reflect.Indirect(field), prefix)
+			if err != nil {
+				return err
+			}
 			continue
 		}
 
-		v, err := enc.scanField(field)
+		// Nested structs hold keys like "db.host"
+		if enc.currentField.IsExported() && !isIgnored(enc.currentField.Tag) && isNestedStruct(enc.currentField.Type) {
+			if (field.Kind() == reflect.Pointer && field.IsNil()) || (isOmitempty(enc.currentField.Tag) && field.IsZero()) {
+				continue
+			}
+			name := cmp.Or(getKeyName(enc.currentField.Tag), enc.currentField.Name)
+			err := enc.scanFields(reflect.Indirect(field), prefix+name+".")
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Skip unexported or ignored groups, and the wildcard field
+		if !enc.currentField.IsExported() || isIgnored(enc.currentField.Tag) || isWildcard(enc.currentField.Tag) {
+			continue
+		}
+
+		err := enc.addKey(field, prefix)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addKey adds the current field to the current group, unless it is omitted.
+func (enc *Encoder) addKey(field reflect.Value, prefix string) error {
+	def, hasDefault := getDefault(enc.currentField.Tag)
+	useDefault := enc.useDefaults && hasDefault && field.IsZero()
+	key := prefix + cmp.Or(getKeyName(enc.currentField.Tag), enc.currentField.Name)
+	enc.currentKeyName = key
+	if isOmitempty(enc.currentField.Tag) && field.IsZero() && !useDefault {
+		omitted := omittedKey{key: key, field: enc.currentField}
+		if v, err := enc.scanField(field); err == nil {
+			omitted.zero = v[""]
+		}
+		enc.omitted[enc.currentGroupName] = append(enc.omitted[enc.currentGroupName], omitted)
+		return nil
+	}
+
+	v := map[string]string{"": def}
+	if !useDefault {
+		var err error
+		v, err = enc.scanField(field)
+		if err != nil {
+			return err
+		}
+		err = enc.scanLines(field, key)
 		if err != nil {
 			return err
 		}
+	}
+
+	if !slices.Contains(enc.keyOrder[enc.currentGroupName], key) {
+		enc.keyOrder[enc.currentGroupName] = append(enc.keyOrder[enc.currentGroupName], key)
+	}
+	enc.groups[enc.currentGroupName][key] = v
+	enc.fields[enc.currentGroupName][key] = enc.currentField
+	enc.setComment(enc.currentGroupName, key, enc.currentField.Tag)
+	return nil
+}
+
+// scanLines keeps the elements of a list field with the lines option, which
+// are written as repeated definitions of the key with AppendDuplicateKeys.
+func (enc *Encoder) scanLines(field reflect.Value, key string) error {
+	if enc.syntax().Duplicates != AppendDuplicateKeys || !isLines(enc.currentField.Tag) {
+		return nil
+	}
+	field = reflect.Indirect(field)
+	if field.Kind() != reflect.Slice {
+		return nil
+	}
 
-		key := cmp.Or(getKeyName(enc.currentField.Tag), enc.currentField.Name)
-		enc.groups[enc.currentGroupName][key] = v
+	elems := make([]string, field.Len())
+	for i := range field.Len() {
+		var err error
+		elems[i], err = enc.encodeValue(field.Index(i))
+		if err != nil {
+			return err
+		}
 	}
+	if _, ok := enc.lines[enc.currentGroupName]; !ok {
+		enc.lines[enc.currentGroupName] = make(map[string][]string)
+	}
+	enc.lines[enc.currentGroupName][key] = elems
+	return nil
+}
+
+// scanGroupMap scans a group that is a map of keys to values. Keys can have a
+// locale, like "Name[de]".
+func (enc *Encoder) scanGroupMap(rv reflect.Value) error {
+	for _, fullKey := range sortedMapKeys(rv) {
+		enc.currentField = reflect.StructField{Name: fullKey.String(), Type: rv.Type().Elem()}
+		enc.currentKeyName = fullKey.String()
 
+		v, err := enc.scanField(rv.MapIndex(fullKey))
+		if err != nil {
+			return err
+		}
+
+		key, locale := splitKey(fullKey.String())
+		if !slices.Contains(enc.keyOrder[enc.currentGroupName], key) {
+			enc.keyOrder[enc.currentGroupName] = append(enc.keyOrder[enc.currentGroupName], key)
+		}
+		if _, ok := enc.groups[enc.currentGroupName][key]; !ok {
+			enc.groups[enc.currentGroupName][key] = make(map[string]string)
+		}
+		for subkey, value := range v {
+			enc.groups[enc.currentGroupName][key][cmp.Or(locale, subkey)] = value
+		}
+		enc.fields[enc.currentGroupName][key] = enc.currentField
+	}
 	return nil
 }
 
 func (enc *Encoder) scanField(rv reflect.Value) (map[string]string, error) {
-	if rv.Kind() == reflect.Pointer {
+	if rv.Kind() == reflect.Pointer && rv.Type() != locationType {
 		return enc.scanField(rv.Elem())
 	}
 
 	if rv.Kind() == reflect.Map {
 		value, err := enc.encodeMapValue(rv)
 		if err != nil {
-			if errors.Is(err, ErrUnsupportedValueType{}) {
-				return nil, ErrUnsupportedValueType{
-					FieldName: enc.currentField.Name,
-					FieldType: enc.currentField.Type.String(),
-				}
-			}
-			return nil, err
+			return nil, enc.valueError(err)
 		}
 
 		return value, nil
@@ -146,13 +446,7 @@ func (enc *Encoder) scanField(rv reflect.Value) (map[string]string, error) {
 
 	value, err := enc.encodeValue(rv)
 	if err != nil {
-		if errors.Is(err, ErrUnsupportedValueType{}) {
-			return nil, ErrUnsupportedValueType{
-				FieldName: enc.currentField.Name,
-				FieldType: enc.currentField.Type.String(),
-			}
-		}
-		return nil, err
+		return nil, enc.valueError(err)
 	}
 
 	return map[string]string{
@@ -160,17 +454,51 @@ func (enc *Encoder) scanField(rv reflect.Value) (map[string]string, error) {
 	}, nil
 }
 
+// valueError adds the current field and key to an error of encodeValue.
+func (enc *Encoder) valueError(err error) error {
+	pos := Position{Group: enc.currentGroupName, Key: enc.currentKeyName}
+	if errors.Is(err, ErrUnsupportedValueType{}) {
+		return ErrUnsupportedValueType{
+			FieldName: enc.currentField.Name,
+			FieldType: enc.currentField.Type.String(),
+			Position:  pos,
+		}
+	}
+	var optionErr ErrInvalidOption
+	if errors.As(err, &optionErr) {
+		optionErr.Position = pos
+		return optionErr
+	}
+	return err
+}
+
 func (enc *Encoder) encodeValue(rv reflect.Value) (string, error) {
 	if !rv.IsValid() {
 		return "", nil
 	}
 
-	if reflect.PointerTo(rv.Type()).Implements(reflect.TypeFor[Marshaler]()) {
-		result := rv.MethodByName("MarshalKeyFile").Call([]reflect.Value{})
-		if !result[1].IsNil() {
-			return "", result[1].Interface().(error)
+	if isTimeType(rv.Type()) {
+		return enc.encodeTime(rv), nil
+	}
+
+	if unit, ok := getOption(enc.currentField.Tag, "unit"); ok && isInteger(rv.Kind()) {
+		return encodeUnit(enc.currentField, rv, unit)
+	}
+
+	if marshaler, ok := addressable(rv).Addr().Interface().(Marshaler); ok {
+		b, err := marshaler.MarshalKeyFile()
+		if err != nil {
+			return "", err
 		}
-		return string(result[0].Bytes()), nil
+		return string(b), nil
+	}
+
+	if marshaler, ok := addressable(rv).Addr().Interface().(encoding.TextMarshaler); ok {
+		b, err := marshaler.MarshalText()
+		if err != nil {
+			return "", err
+		}
+		return enc.syntax().escape(string(b)), nil
 	}
 
 	switch rv.Kind() {
@@ -178,16 +506,27 @@ func (enc *Encoder) encodeValue(rv reflect.Value) (string, error) {
 		return enc.encodeValue(rv.Elem())
 
 	case reflect.String:
-		return escape(rv.String()), nil
+		return enc.syntax().escape(rv.String()), nil
 
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		return strconv.FormatInt(rv.Int(), 10), nil
+		base, err := integerBase(enc.currentField, false)
+		if err != nil {
+			return "", err
+		}
+		return formatInt(rv.Int(), base), nil
 
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-		return strconv.FormatUint(rv.Uint(), 10), nil
+		base, err := integerBase(enc.currentField, false)
+		if err != nil {
+			return "", err
+		}
+		return formatUint(rv.Uint(), base), nil
 
 	case reflect.Bool:
-		return strconv.FormatBool(rv.Bool()), nil
+		if rv.Bool() {
+			return enc.syntax().escape(cmp.Or(enc.boolTrue, "true")), nil
+		}
+		return enc.syntax().escape(cmp.Or(enc.boolFalse, "false")), nil
 
 	case reflect.Float32, reflect.Float64:
 		return strconv.FormatFloat(rv.Float(), 'f', -1, 64), nil
@@ -200,7 +539,7 @@ func (enc *Encoder) encodeValue(rv reflect.Value) (string, error) {
 
 	case reflect.Slice:
 		result := make([]string, 0)
-		sep := getSeperator(enc.currentField.Tag)
+		sep := cmp.Or(getSeperator(enc.currentField.Tag), enc.syntax().listSeparator())
 		for i := range rv.Len() {
 			v, err := enc.encodeValue(rv.Index(i))
 			if err != nil {
@@ -208,13 +547,24 @@ func (enc *Encoder) encodeValue(rv reflect.Value) (string, error) {
 			}
 			result = append(result, v)
 		}
-		return strings.Join(result, sep), nil
+		return joinList(result, sep, enc.syntax().LiteralBackslashes), nil
 
 	default:
 		return "", ErrUnsupportedValueType{}
 	}
 }
 
+// addressable returns rv, or an addressable copy of it, so that methods with
+// pointer receivers can be called.
+func addressable(rv reflect.Value) reflect.Value {
+	if rv.CanAddr() {
+		return rv
+	}
+	v := reflect.New(rv.Type()).Elem()
+	v.Set(rv)
+	return v
+}
+
 func (enc *Encoder) encodeMapValue(rv reflect.Value) (map[string]string, error) {
 	result := make(map[string]string)
 	iter := rv.MapRange()
@@ -231,53 +581,181 @@ func (enc *Encoder) encodeMapValue(rv reflect.Value) (map[string]string, error)
 	return result, nil
 }
 
+func (enc *Encoder) setComment(groupName, key string, tag reflect.StructTag) {
+	comment := getComment(tag)
+	if comment == "" {
+		return
+	}
+	if _, ok := enc.comments[groupName]; !ok {
+		enc.comments[groupName] = make(map[string]string)
+	}
+	enc.comments[groupName][key] = comment
+}
+
+// writeComment writes the comment of a group or key unless the document
+// already has one there.
+func (enc *Encoder) writeComment(doc *Document, groupName, key string) error {
+	comment := enc.comments[groupName][key]
+	if comment == "" || (key != "" && !doc.HasKey(groupName, key)) {
+		return nil
+	}
+	existing, err := doc.GetComment(groupName, key)
+	if err != nil || existing != "" {
+		return err
+	}
+	return doc.SetComment(groupName, key, comment)
+}
+
+// isUnchanged reports whether an existing raw value decodes to the same value
+// as the encoded one, so that equivalent spellings like "a;b;" and "a;b" are
+// not rewritten.
+func (enc *Encoder) isUnchanged(field reflect.StructField, existing, value string) bool {
+	if existing == value {
+		return true
+	}
+
+	rt := field.Type
+	for rt.Kind() == reflect.Pointer {
+		rt = rt.Elem()
+	}
+	if rt.Kind() == reflect.Map {
+		rt = rt.Elem()
+	}
+
+	dec := &Decoder{currentField: field, boolSyntax: ExtendedBoolSyntax, dialect: enc.syntax()}
+	a, err := dec.decodeValue(rt, existing)
+	if err != nil {
+		return false
+	}
+	b, err := dec.decodeValue(rt, value)
+	if err != nil {
+		return false
+	}
+	return reflect.DeepEqual(a.Interface(), b.Interface())
+}
+
 func (enc *Encoder) write() error {
-	groupIndexes := make([]string, 0)
-	for group := range enc.groups {
-		groupIndexes = append(groupIndexes, group)
+	doc := enc.doc
+	if doc == nil {
+		doc = NewDocument()
+		doc.dialect = enc.dialect
+	}
+
+	if enc.header != "" {
+		err := doc.SetComment("", "", enc.header)
+		if err != nil {
+			return err
+		}
+	}
+
+	groupIndexes := slices.Clone(enc.groupOrder)
+	if enc.order == SortedOrder {
+		// The groups of a slice are sorted by its pattern to keep their order
+		slices.SortStableFunc(groupIndexes, func(a, b string) int {
+			return cmp.Compare(cmp.Or(enc.slicePatterns[a], a), cmp.Or(enc.slicePatterns[b], b))
+		})
+	}
+
+	// The root group comes first whatever the order
+	if i := slices.Index(groupIndexes, ""); i > 0 {
+		groupIndexes = slices.Insert(slices.Delete(groupIndexes, i, i+1), 0, "")
 	}
-	sort.Strings(groupIndexes)
 
 	for i := range groupIndexes {
-		if i > 0 {
-			_, err := fmt.Fprintln(enc.w)
-			if err != nil {
-				return err
+		groupName := groupIndexes[i]
+
+		// Keys that are left out by omitempty do not keep their old value,
+		// unless it is the zero value
+		for _, omitted := range enc.omitted[groupName] {
+			node := doc.lookup(groupName, omitted.key, "")
+			if node != nil && enc.isUnchanged(omitted.field, node.value, omitted.zero) {
+				continue
 			}
+			doc.removeKey(groupName, omitted.key)
 		}
-		_, err := fmt.Fprintln(enc.w, fmt.Sprintf("[%s]", groupIndexes[i]))
+
+		if !doc.hasGroup(groupName) {
+			// Do not add empty groups to an existing document
+			if enc.doc != nil && len(enc.groups[groupName]) == 0 {
+				continue
+			}
+			doc.AddGroup(groupName)
+		}
+		err := enc.writeComment(doc, groupName, "")
 		if err != nil {
 			return err
 		}
 
-		keyIndexes := make([]string, 0)
-		for key := range enc.groups[groupIndexes[i]] {
-			keyIndexes = append(keyIndexes, key)
+		keyIndexes := slices.Clone(enc.keyOrder[groupName])
+		if enc.order == SortedOrder {
+			slices.Sort(keyIndexes)
 		}
-		sort.Strings(keyIndexes)
 
 		for j := range keyIndexes {
-			subkeyIndexes := make([]string, 0)
-			for subkey := range enc.groups[groupIndexes[i]][keyIndexes[j]] {
-				subkeyIndexes = append(subkeyIndexes, subkey)
+			values := enc.groups[groupName][keyIndexes[j]]
+			if elems, ok := enc.lines[groupName][keyIndexes[j]]; ok {
+				writeLines(doc, groupName, keyIndexes[j], elems)
+				values = nil
 			}
-			sort.Strings(subkeyIndexes)
-
-			for k := range subkeyIndexes {
-				line := keyIndexes[j]
-
-				if subkeyIndexes[k] != "" {
-					line += fmt.Sprintf("[%s]", subkeyIndexes[k])
+			for _, subkey := range slices.Sorted(maps.Keys(values)) {
+				value := values[subkey]
+				node := doc.lookup(groupName, keyIndexes[j], subkey)
+				if node != nil && enc.isUnchanged(enc.fields[groupName][keyIndexes[j]], node.value, value) {
+					continue
 				}
-
-				line += fmt.Sprintf("=%s", enc.groups[groupIndexes[i]][keyIndexes[j]][subkeyIndexes[k]])
-				_, err := fmt.Fprintln(enc.w, line)
-				if err != nil {
-					return err
+				// Values that are already quoted in the document keep their quotes
+				if (node == nil || !node.quoted) && doc.dialect.needsQuotes(value) {
+					value = doc.dialect.quote(value)
 				}
+				doc.set(groupName, keyIndexes[j], subkey, value)
+			}
+			err := enc.writeComment(doc, groupName, keyIndexes[j])
+			if err != nil {
+				return err
 			}
 		}
 	}
 
+	_, err := doc.WriteTo(enc.w)
+	if err != nil {
+		return err
+	}
+
 	return enc.w.Flush()
 }
+
+// writeLines writes every element as a definition of the key. The definitions
+// that are already in the document are updated in order, and the ones that
+// are left over are removed.
+func writeLines(doc *Document, groupName, key string, elems []string) {
+	// An empty list is written as an empty value, which clears the list
+	if len(elems) == 0 {
+		elems = []string{""}
+	}
+
+	var nodes []*Node
+	for _, node := range doc.entries(groupName, key) {
+		if node.locale == "" {
+			nodes = append(nodes, node)
+		}
+	}
+	for i, value := range elems {
+		var node *Node
+		if i < len(nodes) {
+			node = nodes[i]
+		}
+		if (node == nil || !node.quoted) && doc.dialect.needsQuotes(value) {
+			value = doc.dialect.quote(value)
+		}
+		if node != nil {
+			node.SetValue(value)
+			continue
+		}
+		doc.appendEntry(groupName, key, value)
+	}
+	for _, node := range nodes[min(len(elems), len(nodes)):] {
+		for _, group := range doc.groupsNamed(groupName) {
+			group.RemoveNode(node)
+		}
+	}
+}
@@ -1,9 +1,9 @@
 package keyfile
 
 import (
+	"bytes"
 	"errors"
 	"testing"
-	"time"
 )
 
 func TestEncoder(t *testing.T) {
@@ -35,19 +35,21 @@ func TestEncoder(t *testing.T) {
 			err: ErrInvalidGroupType{
 				GroupName: "ExampleField",
 				GroupType: "string",
+				Position:  Position{Group: "ExampleField"},
 			},
 		},
 		{
 			name: "invalid field type",
 			model: struct {
 				ExampleGroup struct {
-					ExampleField time.Time `keyfile:"example_field"`
+					ExampleField chan int `keyfile:"example_field"`
 				} `keyfile:"example_group"`
 			}{},
 			want: "",
 			err: ErrUnsupportedValueType{
 				FieldName: "ExampleField",
-				FieldType: "time.Time",
+				FieldType: "chan int",
+				Position:  Position{Group: "example_group", Key: "example_field"},
 			},
 		},
 		// valid
@@ -192,6 +194,28 @@ func TestEncoder(t *testing.T) {
 			want: "[group]\nkey1=42\nkey2=42.5\nkey3=value\nkey4=true\nkey5=1;2;3\nkey6=42\n",
 			err:  nil,
 		},
+		{
+			name: "slice field with separators",
+			model: struct {
+				Group struct {
+					Key1 []string `keyfile:"key1"`
+					Key2 []string `keyfile:"key2;sep:,"`
+					Key3 []string `keyfile:"key3"`
+				} `keyfile:"group"`
+			}{
+				Group: struct {
+					Key1 []string "keyfile:\"key1\""
+					Key2 []string "keyfile:\"key2;sep:,\""
+					Key3 []string "keyfile:\"key3\""
+				}{
+					Key1: []string{"a;b", "c\\"},
+					Key2: []string{"a,b", "c;d"},
+					Key3: []string{"a", ""},
+				},
+			},
+			want: "[group]\nkey1=a\\;b;c\\\\\nkey2=a\\,b,c;d\nkey3=a;;\n",
+			err:  nil,
+		},
 		{
 			name: "nil field",
 			model: struct {
@@ -319,3 +343,170 @@ func TestEncoder(t *testing.T) {
 		})
 	}
 }
+
+func TestEncoderOrder(t *testing.T) {
+	model := struct {
+		Entry struct {
+			Type string `keyfile:"Type"`
+			Name string `keyfile:"Name"`
+			Exec string `keyfile:"Exec"`
+		} `keyfile:"Desktop Entry"`
+		Action struct {
+			Name string `keyfile:"Name"`
+		} `keyfile:"Desktop Action new"`
+	}{}
+	model.Entry.Type = "Application"
+	model.Entry.Name = "Example"
+	model.Entry.Exec = "example"
+	model.Action.Name = "New"
+
+	tests := []struct {
+		name  string
+		order Order
+		want  string
+	}{
+		{
+			name:  "sorted",
+			order: SortedOrder,
+			want:  "[Desktop Action new]\nName=New\n\n[Desktop Entry]\nExec=example\nName=Example\nType=Application\n",
+		},
+		{
+			name:  "declaration",
+			order: DeclarationOrder,
+			want:  "[Desktop Entry]\nType=Application\nName=Example\nExec=example\n\n[Desktop Action new]\nName=New\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			enc := NewEncoder(&buf)
+			enc.SetOrder(tt.order)
+			err := enc.Encode(model)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != tt.want {
+				t.Fatalf("got %q, want %q", buf.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestEncoderDocument(t *testing.T) {
+	src := "# app settings\n[general]\n# user name\nname = old\nunknown=kept\n\n[other]\nkey=value\n"
+	doc, err := ParseDocument([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	model := struct {
+		General struct {
+			Name    string `keyfile:"name"`
+			Verbose bool   `keyfile:"verbose"`
+			Level   int    `keyfile:"level"`
+		} `keyfile:"general"`
+		Extra struct {
+			Key string `keyfile:"key"`
+		} `keyfile:"extra"`
+	}{}
+	model.General.Name = "new"
+	model.General.Verbose = true
+	model.General.Level = 2
+	model.Extra.Key = "value"
+
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	enc.SetOrder(DeclarationOrder)
+	enc.SetDocument(doc)
+	err = enc.Encode(model)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "# app settings\n[general]\n# user name\nname = new\nunknown=kept\nverbose=true\nlevel=2\n\n[other]\nkey=value\n\n[extra]\nkey=value\n"
+	if buf.String() != want {
+		t.Fatalf("got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestEncoderComments(t *testing.T) {
+	model := struct {
+		Server struct {
+			Host string `keyfile:"host" comment:"address to listen on"`
+			Port int    `keyfile:"port" comment:"port to listen on\nmust be above 1024"`
+		} `keyfile:"server" comment:"HTTP server"`
+		Log struct {
+			Level string `keyfile:"level"`
+		} `keyfile:"log" comment:"logging"`
+	}{}
+	model.Server.Host = "localhost"
+	model.Server.Port = 8080
+	model.Log.Level = "info"
+
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	enc.SetOrder(DeclarationOrder)
+	enc.SetHeader("generated by example")
+	err := enc.Encode(model)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `# generated by example
+
+# HTTP server
+[server]
+# address to listen on
+host=localhost
+# port to listen on
+# must be above 1024
+port=8080
+
+# logging
+[log]
+level=info
+`
+	if buf.String() != want {
+		t.Fatalf("got %q, want %q", buf.String(), want)
+	}
+
+	dec := NewDecoder(&buf)
+	err = dec.Decode(&model)
+	if err != nil {
+		t.Fatal(err)
+	}
+	comment, err := dec.Document().GetComment("server", "port")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if comment != "port to listen on\nmust be above 1024" {
+		t.Fatalf("got comment %q", comment)
+	}
+}
+
+func TestEncoderDefaults(t *testing.T) {
+	model := struct {
+		Server struct {
+			Host  string   `keyfile:"host" default:"localhost"`
+			Port  int      `keyfile:"port" default:"8080"`
+			Tags  []string `keyfile:"tags,omitempty;sep:," default:"a,b"`
+			Debug bool     `keyfile:"debug"`
+		} `keyfile:"server"`
+	}{}
+	model.Server.Port = 9090
+
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	enc.SetOrder(DeclarationOrder)
+	enc.UseDefaults()
+	err := enc.Encode(model)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "[server]\nhost=localhost\nport=9090\ntags=a,b\ndebug=false\n"
+	if got := buf.String(); got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
@@ -3,6 +3,7 @@ package keyfile
 import (
 	"errors"
 	"fmt"
+	"strings"
 )
 
 var (
@@ -18,58 +19,93 @@ var (
 type ErrUnsupportedValueType struct {
 	FieldName string
 	FieldType string
+	Position
 }
 
 func (e ErrUnsupportedValueType) Error() string {
 	if e.FieldName == "" || e.FieldType == "" {
-		return "keyfile: unsupported value type"
+		return "keyfile: " + e.prefix() + "unsupported value type"
 	}
-	return fmt.Sprintf("keyfile: unsupported value type: %s %s", e.FieldName, e.FieldType)
+	return fmt.Sprintf("keyfile: %sunsupported value type: %s %s", e.prefix(), e.FieldName, e.FieldType)
 }
 
 type ErrInvalidGroupName struct {
-	Line       string
-	LineNumber int
+	Line string
+	Position
 }
 
 func (e ErrInvalidGroupName) Error() string {
-	return fmt.Sprintf("keyfile: line[%d] -> invalid group name: %q", e.LineNumber, e.Line)
+	return fmt.Sprintf("keyfile: %sinvalid group name: %q", e.prefix(), e.Line)
 }
 
 type ErrKeyValuePairMustBeContainedInAGroup struct {
-	Line       string
-	LineNumber int
+	Line string
+	Position
 }
 
 func (e ErrKeyValuePairMustBeContainedInAGroup) Error() string {
-	return fmt.Sprintf("keyfile: line[%d] -> key-value pair must be contained in a group: %q", e.LineNumber, e.Line)
+	return fmt.Sprintf("keyfile: %skey-value pair must be contained in a group: %q", e.prefix(), e.Line)
+}
+
+// ErrDuplicateKey is returned for a key that is defined more than once in a
+// group, if the Dialect rejects duplicate keys.
+type ErrDuplicateKey struct {
+	Line string
+	Position
+}
+
+func (e ErrDuplicateKey) Error() string {
+	return fmt.Sprintf("keyfile: %sduplicate key %q in group %q", e.prefix(), e.Key, e.Group)
 }
 
 type ErrInvalidEntry struct {
-	Line       string
-	LineNumber int
+	Line string
+	Position
 }
 
 func (e ErrInvalidEntry) Error() string {
-	return fmt.Sprintf("keyfile: line[%d] -> invalid entry: %q", e.LineNumber, e.Line)
+	return fmt.Sprintf("keyfile: %sinvalid entry: %q", e.prefix(), e.Line)
 }
 
 type ErrInvalidKey struct {
-	Line       string
-	LineNumber int
+	Line string
+	Position
 }
 
 func (e ErrInvalidKey) Error() string {
-	return fmt.Sprintf("keyfile: line[%d] -> invalid key: %q", e.LineNumber, e.Line)
+	return fmt.Sprintf("keyfile: %sinvalid key: %q", e.prefix(), e.Line)
+}
+
+type ErrInvalidEscape struct {
+	Line     string
+	Sequence string
+	Position
+}
+
+func (e ErrInvalidEscape) Error() string {
+	return fmt.Sprintf("keyfile: %sinvalid escape sequence %q: %q", e.prefix(), e.Sequence, e.Line)
 }
 
 type ErrInvalidGroupType struct {
 	GroupName string
 	GroupType string
+	Position
 }
 
 func (e ErrInvalidGroupType) Error() string {
-	return fmt.Sprintf("keyfile: invalid group type: %s %s", e.GroupName, e.GroupType)
+	return fmt.Sprintf("keyfile: %sinvalid group type: %s %s", e.prefix(), e.GroupName, e.GroupType)
+}
+
+// ErrMissingWildcard is returned by the encoder for a slice of groups whose
+// element type has no wildcard field to build the group names from.
+type ErrMissingWildcard struct {
+	GroupName string
+	GroupType string
+	Position
+}
+
+func (e ErrMissingWildcard) Error() string {
+	return fmt.Sprintf("keyfile: %sgroup slice without a wildcard field: %s %s", e.prefix(), e.GroupName, e.GroupType)
 }
 
 type ErrCanNotParsed struct {
@@ -77,8 +113,198 @@ type ErrCanNotParsed struct {
 	SourceKey  string
 	TargetName string
 	TargetType string
+	Position
 }
 
 func (e ErrCanNotParsed) Error() string {
-	return fmt.Sprintf("keyfile: can not parsed: from %q to \"%s %s\": %s", e.SourceKey, e.TargetName, e.TargetType, e.Err)
+	return fmt.Sprintf("keyfile: %scan not parsed: from %q in group %q to \"%s %s\": %s", e.prefix(), e.SourceKey, e.Group, e.TargetName, e.TargetType, e.Err)
+}
+
+func (e ErrCanNotParsed) Unwrap() error {
+	return e.Err
+}
+
+type ErrGroupNotFound struct {
+	Position
+}
+
+func (e ErrGroupNotFound) Error() string {
+	return fmt.Sprintf("keyfile: %sgroup not found: %q", e.prefix(), e.Group)
+}
+
+type ErrKeyNotFound struct {
+	Position
+}
+
+func (e ErrKeyNotFound) Error() string {
+	return fmt.Sprintf("keyfile: %skey not found: %q in group %q", e.prefix(), e.Key, e.Group)
+}
+
+// ErrMissingRequired is returned by Decode for a required group or key that
+// is not in the input. Key is empty for groups.
+type ErrMissingRequired struct {
+	Position
+}
+
+func (e ErrMissingRequired) Error() string {
+	if e.Key == "" {
+		return fmt.Sprintf("keyfile: %smissing required group %q", e.prefix(), e.Group)
+	}
+	return fmt.Sprintf("keyfile: %smissing required key %q in group %q", e.prefix(), e.Key, e.Group)
+}
+
+type ErrInvalidValue struct {
+	Err error
+	Position
+}
+
+func (e ErrInvalidValue) Error() string {
+	if e.Key == "" {
+		return fmt.Sprintf("keyfile: %sinvalid group %q: %s", e.prefix(), e.Group, e.Err)
+	}
+	return fmt.Sprintf("keyfile: %sinvalid value of %q in group %q: %s", e.prefix(), e.Key, e.Group, e.Err)
+}
+
+func (e ErrInvalidValue) Unwrap() error {
+	return e.Err
+}
+
+// ErrConstraint is the error of a value that does not satisfy a validation
+// option of its field, like "min:1". It is wrapped in an ErrInvalidValue.
+type ErrConstraint struct {
+	Option string
+}
+
+func (e ErrConstraint) Error() string {
+	return fmt.Sprintf("does not satisfy %q", e.Option)
+}
+
+// ErrInvalidOption is returned for an option of the keyfile tag that can not
+// be parsed or does not apply to the type of the field, at the position of the
+// value of the field.
+type ErrInvalidOption struct {
+	FieldName string
+	Option    string
+	Err       error
+	Position
+}
+
+func (e ErrInvalidOption) Error() string {
+	return fmt.Sprintf("keyfile: %sinvalid option %q of field %s: %s", e.prefix(), e.Option, e.FieldName, e.Err)
+}
+
+func (e ErrInvalidOption) Unwrap() error {
+	return e.Err
+}
+
+type ErrUnknownGroup struct {
+	Position
+}
+
+func (e ErrUnknownGroup) Error() string {
+	return fmt.Sprintf("keyfile: %sunknown group: %q", e.prefix(), e.Group)
+}
+
+type ErrUnknownKey struct {
+	Position
+}
+
+func (e ErrUnknownKey) Error() string {
+	return fmt.Sprintf("keyfile: %sunknown key %q in group %q", e.prefix(), e.Key, e.Group)
+}
+
+// Position is the location of an error in the source. Column is the 1-based
+// byte offset in the line. Group and Key are empty where they do not apply,
+// and LineNumber and Column are 0 for errors about something that is missing
+// from the source or about a Go type.
+type Position struct {
+	FileName   string
+	LineNumber int
+	Column     int
+	Group      string
+	Key        string
+}
+
+// Pos returns the position. It is promoted to every error that embeds a
+// Position, so those errors can be matched with errors.As against
+// interface{ Pos() Position }.
+func (p Position) Pos() Position {
+	return p
+}
+
+// String returns the position like "app.conf:3:8". The line and the column
+// are left out when they are 0.
+func (p Position) String() string {
+	pos := p.FileName
+	if p.LineNumber > 0 {
+		pos = fmt.Sprintf("%s:%d", pos, p.LineNumber)
+		if p.Column > 0 {
+			pos = fmt.Sprintf("%s:%d", pos, p.Column)
+		}
+	}
+	return strings.TrimPrefix(pos, ":")
+}
+
+// prefix returns the position followed by a colon to start an error message,
+// or nothing if the position is unknown.
+func (p Position) prefix() string {
+	if pos := p.String(); pos != "" {
+		return pos + ": "
+	}
+	return ""
+}
+
+// Excerpt renders err in the style of a compiler diagnostic: every error in
+// err that has a position is followed by the offending line of src and a
+// caret under the column. Errors joined with errors.Join are rendered one
+// after another.
+func Excerpt(err error, src []byte) string {
+	lines := strings.Split(string(src), "\n")
+
+	var b strings.Builder
+	for _, err := range flattenErrors(err) {
+		b.WriteString(err.Error())
+		b.WriteString("\n")
+
+		var positioned interface{ Pos() Position }
+		if !errors.As(err, &positioned) {
+			continue
+		}
+		pos := positioned.Pos()
+		if pos.LineNumber < 1 || pos.LineNumber > len(lines) {
+			continue
+		}
+
+		line := strings.TrimRight(lines[pos.LineNumber-1], "\r")
+		gutter := fmt.Sprintf("%5d | ", pos.LineNumber)
+		fmt.Fprintf(&b, "%s%s\n", gutter, line)
+
+		// Keep tabs so that the caret lines up with the column, and pad
+		// multi-byte characters with a single space
+		padding := make([]rune, 0, pos.Column)
+		for _, r := range line[:max(min(pos.Column-1, len(line)), 0)] {
+			if r == '\t' {
+				padding = append(padding, '\t')
+			} else {
+				padding = append(padding, ' ')
+			}
+		}
+		fmt.Fprintf(&b, "%s| %s^\n", strings.Repeat(" ", len(gutter)-2), string(padding))
+	}
+	return b.String()
+}
+
+func flattenErrors(err error) []error {
+	if err == nil {
+		return nil
+	}
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		return []error{err}
+	}
+	errs := make([]error, 0)
+	for _, err := range joined.Unwrap() {
+		errs = append(errs, flattenErrors(err)...)
+	}
+	return errs
 }
@@ -2,31 +2,78 @@ package keyfile
 
 import (
 	"cmp"
+	"encoding"
+	"errors"
 	"reflect"
-	"regexp"
 	"slices"
 	"strings"
+	"unicode/utf8"
 )
 
 func isOmitempty(tag reflect.StructTag) bool {
+	return hasFlag(tag, "omitempty")
+}
+
+// isRequired reports whether the tag has the required option. Like the other
+// options that came after omitempty, it must follow a comma, like
+// "port,required", so that "required" alone is still the name of a key.
+func isRequired(tag reflect.StructTag) bool {
+	return hasFlagAfterComma(tag, "required")
+}
+
+func isWildcard(tag reflect.StructTag) bool {
+	return hasFlagAfterComma(tag, "wildcard")
+}
+
+// isRoot reports whether the tag has the root option, like ",root".
+func isRoot(tag reflect.StructTag) bool {
+	return hasFlagAfterComma(tag, "root")
+}
+
+// isLines reports whether the tag has the lines option, like "ExecStart,lines".
+func isLines(tag reflect.StructTag) bool {
+	return hasFlagAfterComma(tag, "lines")
+}
+
+// hasFlagAfterComma is like hasFlag, but the flag can not be the name.
+func hasFlagAfterComma(tag reflect.StructTag, flag string) bool {
+	tagField, ok := tag.Lookup(structTag)
+	if !ok {
+		return false
+	}
+	for _, part := range split(tagField, ";") {
+		_, flags, _ := strings.Cut(part, ",")
+		if slices.ContainsFunc(strings.Split(flags, ","), func(p string) bool {
+			return strings.TrimSpace(p) == flag
+		}) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasFlag reports whether the name part of the tag contains the comma
+// separated flag, like "key,omitempty".
+func hasFlag(tag reflect.StructTag, flag string) bool {
 	tagField, ok := tag.Lookup(structTag)
 	if !ok {
 		return false
 	}
 	parts := split(tagField, ";")
 	for _, part := range parts {
-		if !strings.Contains(part, "omitempty") {
+		if !strings.Contains(part, flag) {
 			continue
 		}
 		subparts := strings.Split(part, ",")
 		if slices.ContainsFunc(subparts, func(p string) bool {
-			return strings.TrimSpace(p) == "omitempty"
+			return strings.TrimSpace(p) == flag
 		}) {
 			return true
 		}
 	}
 	return false
 }
+
 func isIgnored(tag reflect.StructTag) bool {
 	tagField, ok := tag.Lookup(structTag)
 	if !ok {
@@ -47,9 +94,8 @@ func getKeyName(tag reflect.StructTag) string {
 	for _, part := range parts {
 		part = strings.TrimSpace(part)
 		if !strings.Contains(part, ":") && part != "-" && part != "omitempty" {
-			result := strings.ReplaceAll(part, ",", "")
-			result = strings.ReplaceAll(result, "omitempty", "")
-			return result
+			name, _, _ := strings.Cut(part, ",")
+			return strings.TrimSpace(name)
 		}
 	}
 	return ""
@@ -71,7 +117,159 @@ func getSeperator(tag reflect.StructTag) string {
 		}
 	}
 
-	return cmp.Or(sep, ";")
+	return sep
+}
+
+// getOption returns the value of a "name:value" option of the tag.
+func getOption(tag reflect.StructTag, name string) (string, bool) {
+	tagField, ok := tag.Lookup(structTag)
+	if !ok {
+		return "", false
+	}
+	for _, part := range split(tagField, ";") {
+		part = strings.TrimSpace(part)
+		if value, ok := strings.CutPrefix(part, name+":"); ok {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// isNestedStruct reports whether a field of the type holds keys of its own
+// instead of a single value: a struct, or a pointer to one, that is not
+// decoded and encoded as a value like time.Time.
+func isNestedStruct(rt reflect.Type) bool {
+	if rt.Kind() == reflect.Pointer && rt != locationType {
+		rt = rt.Elem()
+	}
+	if rt.Kind() != reflect.Struct || isTimeType(rt) || isUnmarshaler(rt) {
+		return false
+	}
+	return !reflect.PointerTo(rt).Implements(reflect.TypeFor[Marshaler]()) &&
+		!reflect.PointerTo(rt).Implements(reflect.TypeFor[encoding.TextMarshaler]())
+}
+
+// isGroupType reports whether a field of the model holds one or more groups
+// rather than the value of a key in the root group.
+func isGroupType(rt reflect.Type) bool {
+	if (rt.Kind() == reflect.Map && rt.Key().Kind() == reflect.String) || rt.Kind() == reflect.Slice {
+		rt = rt.Elem()
+		if rt.Kind() == reflect.Interface || (rt.Kind() == reflect.Map && rt.Key().Kind() == reflect.String) {
+			return true
+		}
+	}
+	return isNestedStruct(rt)
+}
+
+// isInline reports whether the keys of a struct field belong to the group of
+// the field, like the fields of an embedded struct without a name in the tag,
+// or of a struct with the inline option.
+func isInline(field reflect.StructField) bool {
+	if !isNestedStruct(field.Type) || isIgnored(field.Tag) {
+		return false
+	}
+	if hasFlagAfterComma(field.Tag, "inline") {
+		return true
+	}
+	if !field.Anonymous || getKeyName(field.Tag) != "" {
+		return false
+	}
+	// Pointers to unexported structs can not be allocated
+	return field.IsExported() || field.Type.Kind() != reflect.Pointer
+}
+
+// matchGroup matches the name of a group against a pattern of fillGroups and
+// returns the matched text. The text of the pattern is compared regardless of
+// case if ignoreCase is set, but the matched text is kept as it is.
+func matchGroup(group, pattern string, ignoreCase bool) (string, bool) {
+	equal := func(a, b string) bool { return a == b }
+	if ignoreCase {
+		equal = strings.EqualFold
+	}
+
+	prefix, suffix, ok := strings.Cut(pattern, "*")
+	if !ok {
+		prefix, suffix = pattern+" ", ""
+	}
+	if len(group) <= len(prefix)+len(suffix) || !equal(group[:len(prefix)], prefix) || !equal(group[len(group)-len(suffix):], suffix) {
+		return "", false
+	}
+	matched := group[len(prefix) : len(group)-len(suffix)]
+	if !ok {
+		return subgroupName(matched)
+	}
+	return matched, true
+}
+
+// groupName returns the name of the group that matches the pattern with the
+// text, the reverse of matchGroup.
+func groupName(pattern, text string) string {
+	if strings.Contains(pattern, "*") {
+		return strings.Replace(pattern, "*", text, 1)
+	}
+	return pattern + ` "` + text + `"`
+}
+
+// subgroupName returns the name of a subgroup like `remote "origin"` from the
+// text after the group name, as written in git config files. The quotes are
+// optional.
+func subgroupName(sub string) (string, bool) {
+	sub = strings.TrimSpace(sub)
+	if len(sub) >= 2 && sub[0] == '"' && sub[len(sub)-1] == '"' {
+		sub = sub[1 : len(sub)-1]
+	}
+	return sub, sub != ""
+}
+
+// wildcardField returns the field of a group struct that holds the text
+// matched by the pattern of the group, marked with the wildcard option.
+func wildcardField(group reflect.Value) (reflect.Value, bool) {
+	for group.Kind() == reflect.Pointer || group.Kind() == reflect.Interface {
+		group = group.Elem()
+	}
+	if group.Kind() != reflect.Struct {
+		return reflect.Value{}, false
+	}
+	for i := range group.NumField() {
+		if isWildcard(group.Type().Field(i).Tag) && group.Field(i).Kind() == reflect.String {
+			return group.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+func setWildcard(group reflect.Value, text string) {
+	if field, ok := wildcardField(group); ok && field.CanSet() {
+		field.SetString(text)
+	}
+}
+
+// splitKey splits a key like "Name[de]" into the key and the locale.
+func splitKey(fullKey string) (string, string) {
+	key, locale, ok := strings.Cut(fullKey, "[")
+	if !ok || !strings.HasSuffix(locale, "]") {
+		return fullKey, ""
+	}
+	return key, strings.TrimSuffix(locale, "]")
+}
+
+// sortedMapKeys returns the keys of a map with string keys in sorted order.
+func sortedMapKeys(rv reflect.Value) []reflect.Value {
+	keys := rv.MapKeys()
+	slices.SortFunc(keys, func(a, b reflect.Value) int {
+		return cmp.Compare(a.String(), b.String())
+	})
+	return keys
+}
+
+func getComment(tag reflect.StructTag) string {
+	return tag.Get("comment")
+}
+
+// getDefault returns the value of the default tag. It is written like a value
+// in a file, so it is escaped and split into lists the same way.
+func getDefault(tag reflect.StructTag) (string, bool) {
+	return tag.Lookup("default")
 }
 
 func split(value string, sep string) []string {
@@ -96,25 +294,153 @@ func split(value string, sep string) []string {
 	return result
 }
 
-func unescape(value string) string {
-	value = strings.ReplaceAll(value, "\\s", " ")
-	value = strings.ReplaceAll(value, "\\n", "\n")
-	value = strings.ReplaceAll(value, "\\r", "\r")
-	value = strings.ReplaceAll(value, "\\t", "\t")
+// splitList splits a raw list value on every separator that is not escaped,
+// or on every separator if backslashes are literal. The elements are returned
+// still escaped. A trailing separator, as written by GLib, does not start a
+// new element.
+func splitList(value, sep string, literal bool) []string {
+	result := make([]string, 0)
+	if value == "" {
+		return result
+	}
+
+	start := 0
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && !literal {
+			i++
+			continue
+		}
+		if strings.HasPrefix(value[i:], sep) {
+			result = append(result, value[start:i])
+			i += len(sep) - 1
+			start = i + 1
+		}
+	}
+	if start < len(value) {
+		result = append(result, value[start:])
+	}
+	return result
+}
+
+// joinList joins escaped list elements, escaping the separator inside them
+// unless backslashes are literal. A separator is appended if the last element
+// is empty, so that it is not lost when the list is read back.
+func joinList(elems []string, sep string, literal bool) string {
+	escaped := make([]string, len(elems))
+	for i := range elems {
+		escaped[i] = elems[i]
+		if !literal {
+			escaped[i] = strings.ReplaceAll(elems[i], sep, "\\"+sep)
+		}
+	}
+	value := strings.Join(escaped, sep)
+	if len(elems) > 0 && elems[len(elems)-1] == "" {
+		value += sep
+	}
 	return value
 }
 
-func replaceSpaces(input string) string {
-	re := regexp.MustCompile(`^\s+|\s+$`)
-	return re.ReplaceAllStringFunc(input, func(match string) string {
-		return strings.Repeat("\\s", len(match))
-	})
+// unescape decodes the escape sequences of a value: \s, \n, \t, \r and \\.
+// If sep is not empty, the value is a list element and an escaped separator
+// decodes to the separator itself. With quotes, \" decodes to a double quote.
+func unescape(value, sep string, quotes bool) (string, error) {
+	if !strings.Contains(value, "\\") {
+		return value, nil
+	}
+
+	var b strings.Builder
+	b.Grow(len(value))
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' {
+			b.WriteByte(value[i])
+			continue
+		}
+
+		i++
+		if i == len(value) {
+			return "", ErrInvalidEscape{Sequence: "\\", Position: Position{Column: i - 1}}
+		}
+
+		switch value[i] {
+		case 's':
+			b.WriteByte(' ')
+		case 'n':
+			b.WriteByte('\n')
+		case 't':
+			b.WriteByte('\t')
+		case 'r':
+			b.WriteByte('\r')
+		case '\\':
+			b.WriteByte('\\')
+		default:
+			if quotes && value[i] == '"' {
+				b.WriteByte('"')
+				continue
+			}
+			if sep != "" && strings.HasPrefix(value[i:], sep) {
+				b.WriteString(sep)
+				i += len(sep) - 1
+				continue
+			}
+			r, _ := utf8.DecodeRuneInString(value[i:])
+			return "", ErrInvalidEscape{Sequence: "\\" + string(r), Position: Position{Column: i - 1}}
+		}
+	}
+	return b.String(), nil
 }
 
+// unescapeAt unescapes a value that starts at pos in the source line in the
+// dialect, and reports invalid escape sequences at their own column.
+func unescapeAt(value, sep string, dialect Dialect, pos Position, line string) (string, error) {
+	if dialect.LiteralBackslashes {
+		return value, nil
+	}
+	v, err := unescape(value, sep, dialect.QuotedValues)
+	var escapeErr ErrInvalidEscape
+	if errors.As(err, &escapeErr) {
+		offset := escapeErr.Column
+		escapeErr.Position = pos
+		escapeErr.Column += offset
+		escapeErr.Line = line
+		return "", escapeErr
+	}
+	return v, err
+}
+
+// escape encodes a value so that it is read back unchanged. Backslashes and
+// control characters are escaped, and so are leading and trailing spaces,
+// which would otherwise be trimmed.
 func escape(value string) string {
-	value = strings.ReplaceAll(value, "\n", "\\n")
-	value = strings.ReplaceAll(value, "\r", "\\r")
-	value = strings.ReplaceAll(value, "\t", "\\t")
-	value = replaceSpaces(value)
-	return value
+	start := 0
+	for start < len(value) && value[start] == ' ' {
+		start++
+	}
+	end := len(value)
+	for end > start && value[end-1] == ' ' {
+		end--
+	}
+
+	var b strings.Builder
+	b.Grow(len(value))
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; {
+		case c == ' ' && (i < start || i >= end):
+			b.WriteString("\\s")
+		case c == '\n':
+			b.WriteString("\\n")
+		case c == '\t':
+			b.WriteString("\\t")
+		case c == '\r':
+			b.WriteString("\\r")
+		case c == '\\':
+			b.WriteString("\\\\")
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+func trimBlank(value string) string {
+	return strings.Trim(value, " \t")
 }
@@ -0,0 +1,87 @@
+package keyfile
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var errInvalidBase = errors.New("base must be 2, 8, 10 or 16")
+
+// integerBase returns the base of the base option of the field. Without the
+// option, it returns 0 if integer literals are allowed and 10 otherwise.
+func integerBase(field reflect.StructField, literals bool) (int, error) {
+	option, ok := getOption(field.Tag, "base")
+	if !ok {
+		if literals {
+			return 0, nil
+		}
+		return 10, nil
+	}
+
+	base, err := strconv.Atoi(option)
+	if err != nil || (base != 2 && base != 8 && base != 10 && base != 16) {
+		return 0, ErrInvalidOption{FieldName: field.Name, Option: "base:" + option, Err: errInvalidBase}
+	}
+	return base, nil
+}
+
+// integerPrefixes are the prefixes of integer literals, like in Go.
+var integerPrefixes = map[int]string{2: "0b", 8: "0o", 16: "0x"}
+
+// hasIntegerPrefix reports whether the value, after its sign, starts with the
+// prefix of an integer literal that is not a number in the base. In base 16,
+// "0b1" is the number 0xb1 and not a binary literal.
+func hasIntegerPrefix(value string, base int) bool {
+	value = strings.TrimLeft(value, "+-")
+	if len(value) < 2 || value[0] != '0' {
+		return false
+	}
+	switch value[1] {
+	case 'b', 'B':
+		return base != 16
+	case 'o', 'O', 'x', 'X':
+		return true
+	}
+	return false
+}
+
+// allowsIntegerPrefix reports whether a value of the field may start with the
+// prefix of an integer literal, which needs the base option or integer
+// literals.
+func allowsIntegerPrefix(field reflect.StructField, literals bool) bool {
+	_, ok := getOption(field.Tag, "base")
+	return ok || literals
+}
+
+// parseInt parses the value in the base, or in the base of its prefix if
+// prefixes are allowed.
+func parseInt(value string, base int, prefixes bool) (int64, error) {
+	if prefixes && hasIntegerPrefix(value, base) {
+		base = 0
+	}
+	return strconv.ParseInt(value, base, 64)
+}
+
+func parseUint(value string, base int, prefixes bool) (uint64, error) {
+	if prefixes && hasIntegerPrefix(value, base) {
+		base = 0
+	}
+	return strconv.ParseUint(value, base, 64)
+}
+
+// formatInt formats an integer in the base, with the prefix of its literal.
+func formatInt(v int64, base int) string {
+	if v < 0 {
+		return "-" + formatUint(uint64(-v), base)
+	}
+	return formatUint(uint64(v), base)
+}
+
+func formatUint(v uint64, base int) string {
+	if base == 0 {
+		base = 10
+	}
+	return integerPrefixes[base] + strconv.FormatUint(v, base)
+}
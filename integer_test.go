@@ -0,0 +1,139 @@
+package keyfile
+
+import (
+	"errors"
+	"io/fs"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestIntegerLiterals(t *testing.T) {
+	type config struct {
+		Group struct {
+			Mode  fs.FileMode `keyfile:"mode;base:8"`
+			Mask  uint8       `keyfile:"mask;base:16"`
+			Color uint32      `keyfile:"color;base:16"`
+			Flags []int       `keyfile:"flags;base:2"`
+			Limit int         `keyfile:"limit"`
+		} `keyfile:"group"`
+	}
+
+	tests := []struct {
+		name     string
+		src      string
+		literals bool
+		want     func(c *config)
+		fail     bool
+	}{
+		{
+			name: "base option",
+			src:  "[group]\nmode=0755\nmask=ff\nflags=101;-0b11\nlimit=10\n",
+			want: func(c *config) {
+				c.Group.Mode = 0o755
+				c.Group.Mask = 0xff
+				c.Group.Flags = []int{5, -3}
+				c.Group.Limit = 10
+			},
+		},
+		{
+			name: "prefix overrides base",
+			src:  "[group]\nmode=0o7_55\nmask=0XFF\n",
+			want: func(c *config) {
+				c.Group.Mode = 0o755
+				c.Group.Mask = 0xff
+			},
+		},
+		{
+			name: "hex digits that look like a prefix",
+			src:  "[group]\nmask=0B1\n",
+			want: func(c *config) {
+				c.Group.Mask = 0xb1
+			},
+		},
+		{
+			name: "hex number with a leading zero and b",
+			src:  "[group]\ncolor=0bad\n",
+			want: func(c *config) {
+				c.Group.Color = 0xbad
+			},
+		},
+		{
+			name:     "literals",
+			src:      "[group]\nlimit=1_000_000\n",
+			literals: true,
+			want: func(c *config) {
+				c.Group.Limit = 1_000_000
+			},
+		},
+		{
+			name: "literals are not allowed by default",
+			src:  "[group]\nlimit=1_000_000\n",
+			fail: true,
+		},
+		{
+			name: "hex prefix is not allowed by default",
+			src:  "[group]\nlimit=0x1_0\n",
+			fail: true,
+		},
+		{
+			name: "binary prefix is not allowed by default",
+			src:  "[group]\nlimit=-0b11\n",
+			fail: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got, want config
+			dec := NewDecoder(strings.NewReader(tt.src))
+			if tt.literals {
+				dec.UseIntegerLiterals()
+			}
+			err := dec.Decode(&got)
+			var parseErr ErrCanNotParsed
+			if tt.fail {
+				if !errors.As(err, &parseErr) {
+					t.Fatalf("got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.want(&want)
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("got %+v, want %+v", got, want)
+			}
+		})
+	}
+
+	var src config
+	src.Group.Mode = 0o640
+	src.Group.Mask = 0x1f
+	src.Group.Flags = []int{5, -3}
+	src.Group.Limit = 42
+	data, err := Marshal(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "[group]\ncolor=0x0\nflags=0b101;-0b11\nlimit=42\nmask=0x1f\nmode=0o640\n"
+	if string(data) != want {
+		t.Fatalf("got %q, want %q", data, want)
+	}
+
+	var invalid struct {
+		Group struct {
+			Value int `keyfile:"value;base:3"`
+		} `keyfile:"group"`
+	}
+	_, err = Marshal(invalid)
+	if !errors.Is(err, errInvalidBase) {
+		t.Fatalf("got %v", err)
+	}
+	err = Unmarshal([]byte("[group]\nvalue=1\n"), &invalid)
+	var optionErr ErrInvalidOption
+	if !errors.As(err, &optionErr) || optionErr.Position != (Position{LineNumber: 2, Column: 7, Group: "group", Key: "value"}) {
+		t.Fatalf("got %v", err)
+	}
+}
@@ -28,3 +28,26 @@ func Marshal(v any) ([]byte, error) {
 	}
 	return buf.Bytes(), nil
 }
+
+// Patch writes the values of v into existing keyfile data and returns the
+// result. Only the lines of values that changed are rewritten, missing keys
+// and groups are appended in the order of the struct fields, and comments,
+// unknown groups and keys, locale variants and formatting are left untouched.
+// The keys of fields that are left out by omitempty are removed, unless their
+// value is already the zero value.
+func Patch(existing []byte, v any) ([]byte, error) {
+	doc, err := ParseDocument(existing)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	enc.SetOrder(DeclarationOrder)
+	enc.SetDocument(doc)
+	err = enc.Encode(v)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
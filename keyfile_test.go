@@ -0,0 +1,686 @@
+package keyfile
+
+import (
+	"errors"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/netip"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"testing/quick"
+)
+
+func TestRoundTripString(t *testing.T) {
+	type config struct {
+		Group struct {
+			Value string `keyfile:"value"`
+		} `keyfile:"group"`
+	}
+
+	roundTrip := func(value string) bool {
+		var src, dst config
+		src.Group.Value = value
+
+		data, err := Marshal(src)
+		if err != nil {
+			t.Log(err)
+			return false
+		}
+		err = Unmarshal(data, &dst)
+		if err != nil {
+			t.Log(err)
+			return false
+		}
+		return dst.Group.Value == value
+	}
+
+	for _, value := range []string{"", " ", "\\", "\\n", "\\\\s", " a b ", "\t\r\n", "\v", "#not a comment", "a=b", "[x]", "\xff\xfe"} {
+		if !roundTrip(value) {
+			t.Fatalf("round trip failed for %q", value)
+		}
+	}
+
+	err := quick.Check(roundTrip, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRoundTripList(t *testing.T) {
+	type config struct {
+		Group struct {
+			Semicolon []string `keyfile:"semicolon"`
+			Comma     []string `keyfile:"comma;sep:,"`
+		} `keyfile:"group"`
+	}
+
+	roundTrip := func(semicolon, comma []string) bool {
+		var src, dst config
+		src.Group.Semicolon = semicolon
+		src.Group.Comma = comma
+
+		data, err := Marshal(src)
+		if err != nil {
+			t.Log(err)
+			return false
+		}
+		err = Unmarshal(data, &dst)
+		if err != nil {
+			t.Log(err)
+			return false
+		}
+		return slices.Equal(dst.Group.Semicolon, semicolon) && slices.Equal(dst.Group.Comma, comma)
+	}
+
+	tests := [][]string{
+		{},
+		{""},
+		{"", ""},
+		{"a;b", "c"},
+		{"a,b", "c,"},
+		{"a\\", "b"},
+		{" a ", `b\;`},
+		{"a", ""},
+	}
+	for _, list := range tests {
+		if !roundTrip(list, list) {
+			t.Fatalf("round trip failed for %q", list)
+		}
+	}
+
+	err := quick.Check(roundTrip, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRoundTripText(t *testing.T) {
+	type config struct {
+		Group struct {
+			IP      net.IP                `keyfile:"ip"`
+			Addr    netip.Addr            `keyfile:"addr"`
+			Int     *big.Int              `keyfile:"int"`
+			Level   slog.Level            `keyfile:"level"`
+			Addrs   []netip.Addr          `keyfile:"addrs;sep:,"`
+			Servers map[string]netip.Addr `keyfile:"servers"`
+		} `keyfile:"group"`
+	}
+
+	var src config
+	src.Group.IP = net.ParseIP("192.168.1.1")
+	src.Group.Addr = netip.MustParseAddr("::1")
+	src.Group.Int, _ = new(big.Int).SetString("123456789012345678901234567890", 10)
+	src.Group.Level = slog.LevelWarn
+	src.Group.Addrs = []netip.Addr{netip.MustParseAddr("10.0.0.1"), netip.MustParseAddr("10.0.0.2")}
+	src.Group.Servers = map[string]netip.Addr{"": netip.MustParseAddr("10.0.0.3"), "de": netip.MustParseAddr("10.0.0.4")}
+
+	data, err := Marshal(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "[group]\naddr=::1\naddrs=10.0.0.1,10.0.0.2\nint=123456789012345678901234567890\nip=192.168.1.1\nlevel=WARN\nservers=10.0.0.3\nservers[de]=10.0.0.4\n"
+	if string(data) != want {
+		t.Fatalf("got %q, want %q", data, want)
+	}
+
+	var dst config
+	err = Unmarshal(data, &dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(dst, src) {
+		t.Fatalf("got %+v, want %+v", dst, src)
+	}
+
+	err = Unmarshal([]byte("[group]\naddr=not an address\n"), &dst)
+	var parseErr ErrCanNotParsed
+	if !errors.As(err, &parseErr) || parseErr.SourceKey != "addr" {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestDecodeList(t *testing.T) {
+	tests := []struct {
+		src  string
+		want []string
+	}{
+		{src: "", want: []string{}},
+		{src: "a;b;", want: []string{"a", "b"}},
+		{src: "a;b;;", want: []string{"a", "b", ""}},
+		{src: `a\;b;c`, want: []string{"a;b", "c"}},
+		{src: `a\\;b`, want: []string{"a\\", "b"}},
+		{src: " a ; b ", want: []string{"a", "b"}},
+	}
+
+	for _, tt := range tests {
+		var dst struct {
+			Group struct {
+				List []string `keyfile:"list"`
+			} `keyfile:"group"`
+		}
+		err := Unmarshal([]byte("[group]\nlist="+tt.src), &dst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(dst.Group.List, tt.want) {
+			t.Fatalf("%q: got %q, want %q", tt.src, dst.Group.List, tt.want)
+		}
+	}
+}
+
+func TestPatch(t *testing.T) {
+	type config struct {
+		Entry struct {
+			Name       LocaleString `keyfile:"Name"`
+			Categories []string     `keyfile:"Categories"`
+			Terminal   bool         `keyfile:"Terminal"`
+			Version    float64      `keyfile:"Version"`
+			Icon       string       `keyfile:"Icon,omitempty"`
+			Exec       string       `keyfile:"Exec"`
+		} `keyfile:"Desktop Entry"`
+		Action *struct {
+			Name string `keyfile:"Name"`
+		} `keyfile:"Desktop Action new"`
+	}
+
+	src := `# generated file
+[Desktop Entry]
+Name = Files
+Name[de] = Dateien
+Categories = Utility;Core;
+Terminal = TRUE
+Version = 1.50
+Unknown = kept
+
+[Vendor]
+key = value
+`
+	var v config
+	err := Unmarshal([]byte(src), &v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v.Entry.Name = LocaleString{"": "Files", "fr": "Fichiers"}
+	v.Entry.Terminal = false
+	v.Entry.Exec = "files %U"
+
+	got, err := Patch([]byte(src), v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `# generated file
+[Desktop Entry]
+Name = Files
+Name[de] = Dateien
+Categories = Utility;Core;
+Terminal = false
+Version = 1.50
+Unknown = kept
+Name[fr]=Fichiers
+Exec=files %U
+
+[Vendor]
+key = value
+`
+	if string(got) != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestPatchOmitempty(t *testing.T) {
+	type config struct {
+		Entry struct {
+			Name string `keyfile:"Name"`
+			Icon string `keyfile:"Icon,omitempty"`
+		} `keyfile:"Desktop Entry"`
+	}
+
+	src := "[Desktop Entry]\nName=a\n# the icon\nIcon=old\nIcon[de]=alt\n"
+	var v config
+	v.Entry.Name = "a"
+	got, err := Patch([]byte(src), v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "[Desktop Entry]\nName=a\n"
+	if string(got) != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	var back config
+	err = Unmarshal(got, &back)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if back != v {
+		t.Fatalf("got %+v, want %+v", back, v)
+	}
+
+	// A zero value that is in the file is kept
+	src = "[Desktop Entry]\nName=a\nIcon=\nPort=0\n"
+	var decoded struct {
+		Entry struct {
+			Name string `keyfile:"Name"`
+			Icon string `keyfile:"Icon,omitempty"`
+			Port int    `keyfile:"Port,omitempty"`
+		} `keyfile:"Desktop Entry"`
+	}
+	err = Unmarshal([]byte(src), &decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = Patch([]byte(src), decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != src {
+		t.Fatalf("got %q, want %q", got, src)
+	}
+}
+
+func TestMapModel(t *testing.T) {
+	src := "[core]\neditor=vim\nName[de]=Kern\n[remote \"origin\"]\nurl=https://example.com\nfetch=a;b\n[plugin]\nenabled=true\nlevel=3\n"
+
+	t.Run("map of maps", func(t *testing.T) {
+		var dst map[string]map[string]string
+		err := Unmarshal([]byte(src), &dst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := map[string]map[string]string{
+			"core":            {"editor": "vim", "Name[de]": "Kern"},
+			`remote "origin"`: {"url": "https://example.com", "fetch": "a;b"},
+			"plugin":          {"enabled": "true", "level": "3"},
+		}
+		if !reflect.DeepEqual(dst, want) {
+			t.Fatalf("got %v, want %v", dst, want)
+		}
+
+		data, err := Marshal(dst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantData := "[core]\nName[de]=Kern\neditor=vim\n\n[plugin]\nenabled=true\nlevel=3\n\n[remote \"origin\"]\nfetch=a;b\nurl=https://example.com\n"
+		if string(data) != wantData {
+			t.Fatalf("got %q, want %q", data, wantData)
+		}
+	})
+
+	t.Run("map of any", func(t *testing.T) {
+		var dst map[string]any
+		err := Unmarshal([]byte(src), &dst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		plugin, ok := dst["plugin"].(map[string]any)
+		if !ok || plugin["enabled"] != true || plugin["level"] != int64(3) {
+			t.Fatalf("got %v", dst)
+		}
+	})
+
+	t.Run("map of structs", func(t *testing.T) {
+		type group struct {
+			Editor  string `keyfile:"editor"`
+			Enabled bool   `keyfile:"enabled"`
+		}
+		var dst map[string]group
+		dec := NewDecoder(strings.NewReader(src))
+		dec.DisallowUnknownFields()
+		err := dec.Decode(&dst)
+		var unknown ErrUnknownKey
+		if !errors.As(err, &unknown) {
+			t.Fatalf("got %v", err)
+		}
+		if dst["core"].Editor != "vim" || !dst["plugin"].Enabled || len(dst) != 3 {
+			t.Fatalf("got %v", dst)
+		}
+	})
+}
+
+func TestSubgroups(t *testing.T) {
+	type remote struct {
+		URL   string   `keyfile:"url"`
+		Fetch []string `keyfile:"fetch"`
+	}
+	type config struct {
+		Core struct {
+			Editor string `keyfile:"editor"`
+		} `keyfile:"core"`
+		Remotes  map[string]remote            `keyfile:"remote,required"`
+		Branches map[string]map[string]string `keyfile:"branch"`
+	}
+
+	src := "[core]\neditor=vim\n[remote \"origin\"]\nurl=https://example.com/a\nfetch=a;b\n[remote upstream]\nurl=https://example.com/b\n[branch \"main\"]\nremote=origin\n"
+	var dst config
+	err := Unmarshal([]byte(src), &dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := config{
+		Remotes: map[string]remote{
+			"origin":   {URL: "https://example.com/a", Fetch: []string{"a", "b"}},
+			"upstream": {URL: "https://example.com/b"},
+		},
+		Branches: map[string]map[string]string{"main": {"remote": "origin"}},
+	}
+	want.Core.Editor = "vim"
+	if !reflect.DeepEqual(dst, want) {
+		t.Fatalf("got %+v, want %+v", dst, want)
+	}
+
+	data, err := Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantData := "[branch \"main\"]\nremote=origin\n\n[core]\neditor=vim\n\n[remote \"origin\"]\nfetch=a;b\nurl=https://example.com/a\n\n[remote \"upstream\"]\nfetch=\nurl=https://example.com/b\n"
+	if string(data) != wantData {
+		t.Fatalf("got %q, want %q", data, wantData)
+	}
+
+	err = Unmarshal([]byte("[core]\n"), &dst)
+	if !errors.Is(err, ErrMissingRequired{Position: Position{Group: "remote"}}) {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestWildcardGroups(t *testing.T) {
+	type action struct {
+		ID   string       `keyfile:",wildcard"`
+		Name LocaleString `keyfile:"Name"`
+		Exec string       `keyfile:"Exec"`
+	}
+	type config struct {
+		Entry struct {
+			Actions []string `keyfile:"Actions"`
+		} `keyfile:"Desktop Entry"`
+		Actions []action           `keyfile:"Desktop Action *"`
+		ByID    map[string]*action `keyfile:"Desktop Action *"`
+	}
+
+	src := `[Desktop Entry]
+Actions=new-window;private;
+
+[Desktop Action new-window]
+Name=New Window
+Name[de]=Neues Fenster
+Exec=app --new-window
+
+[Desktop Action private]
+Name=Private Window
+Exec=app --private
+`
+	var dst config
+	dec := NewDecoder(strings.NewReader(src))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantActions := []action{
+		{ID: "new-window", Name: LocaleString{"": "New Window", "de": "Neues Fenster"}, Exec: "app --new-window"},
+		{ID: "private", Name: LocaleString{"": "Private Window"}, Exec: "app --private"},
+	}
+	if !reflect.DeepEqual(dst.Actions, wantActions) {
+		t.Fatalf("got %+v, want %+v", dst.Actions, wantActions)
+	}
+	if len(dst.ByID) != 2 || !reflect.DeepEqual(*dst.ByID["private"], wantActions[1]) {
+		t.Fatalf("got %+v", dst.ByID)
+	}
+
+	var model struct {
+		Actions []action `keyfile:"Desktop Action *"`
+	}
+	model.Actions = []action{wantActions[1], wantActions[0]}
+	data, err := Marshal(model)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the groups keep the order of the slice
+	want := "[Desktop Action private]\nExec=app --private\nName=Private Window\n\n[Desktop Action new-window]\nExec=app --new-window\nName=New Window\nName[de]=Neues Fenster\n"
+	if string(data) != want {
+		t.Fatalf("got %q, want %q", data, want)
+	}
+
+	var invalid struct {
+		Groups []struct {
+			Key string `keyfile:"key"`
+		} `keyfile:"group *"`
+	}
+	invalid.Groups = make([]struct {
+		Key string `keyfile:"key"`
+	}, 1)
+	_, err = Marshal(invalid)
+	var wildcardErr ErrMissingWildcard
+	if !errors.As(err, &wildcardErr) {
+		t.Fatalf("got %v", err)
+	}
+
+	var values struct {
+		Values []string `keyfile:"values *"`
+	}
+	values.Values = []string{"a"}
+	var groupErr ErrInvalidGroupType
+	if err := Unmarshal([]byte("[values a]\n"), &values); !errors.As(err, &groupErr) {
+		t.Fatalf("decode: got %v", err)
+	}
+	if _, err := Marshal(values); !errors.As(err, &groupErr) {
+		t.Fatalf("encode: got %v", err)
+	}
+
+	var mapped struct {
+		Values map[string]string `keyfile:"values *"`
+	}
+	mapped.Values = map[string]string{"a": "b"}
+	if err := Unmarshal([]byte("[values a]\n"), &mapped); !errors.As(err, &groupErr) {
+		t.Fatalf("decode map: got %v", err)
+	}
+	if _, err := Marshal(mapped); !errors.As(err, &groupErr) {
+		t.Fatalf("encode map: got %v", err)
+	}
+}
+
+type commonSettings struct {
+	Enabled bool   `keyfile:"enabled"`
+	Level   string `keyfile:"level"`
+}
+
+func TestNestedStructs(t *testing.T) {
+	type database struct {
+		Host string `keyfile:"host"`
+		Port int    `keyfile:"port"`
+	}
+	type limits struct {
+		Max int `keyfile:"max"`
+	}
+	type config struct {
+		Server struct {
+			commonSettings
+			Limits  limits    `keyfile:"limits,inline"`
+			DB      database  `keyfile:"db"`
+			Replica *database `keyfile:"replica"`
+			Name    string    `keyfile:"name"`
+		} `keyfile:"server"`
+		Client struct {
+			*commonSettings
+			Name string `keyfile:"name"`
+		} `keyfile:"client"`
+	}
+
+	src := "[server]\nenabled=true\nlevel=debug\nmax=10\ndb.host=localhost\ndb.port=5432\nreplica.host=replica\nname=main\n[client]\nname=cli\n"
+	var dst config
+	dec := NewDecoder(strings.NewReader(src))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var want config
+	want.Server.Enabled = true
+	want.Server.Level = "debug"
+	want.Server.Limits.Max = 10
+	want.Server.DB = database{Host: "localhost", Port: 5432}
+	want.Server.Replica = &database{Host: "replica"}
+	want.Server.Name = "main"
+	want.Client.Name = "cli"
+	if !reflect.DeepEqual(dst, want) {
+		t.Fatalf("got %+v, want %+v", dst, want)
+	}
+
+	data, err := Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantData := "[client]\nname=cli\n\n[server]\ndb.host=localhost\ndb.port=5432\nenabled=true\nlevel=debug\nmax=10\nname=main\nreplica.host=replica\nreplica.port=0\n"
+	if string(data) != wantData {
+		t.Fatalf("got %q, want %q", data, wantData)
+	}
+}
+
+type Common struct {
+	Level string `keyfile:"level"`
+}
+
+func TestNilNestedStructs(t *testing.T) {
+	type database struct {
+		Host string `keyfile:"host"`
+	}
+	type config struct {
+		Server struct {
+			*Common
+			Replica *database `keyfile:"replica"`
+			Name    string    `keyfile:"name"`
+		} `keyfile:"server"`
+	}
+
+	src := "[server]\nname=main\n"
+	var dst config
+	err := Unmarshal([]byte(src), &dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dst.Server.Common != nil || dst.Server.Replica != nil {
+		t.Fatalf("got %+v, want nil pointers", dst.Server)
+	}
+	data, err := Marshal(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != src {
+		t.Fatalf("got %q, want %q", data, src)
+	}
+
+	err = Unmarshal([]byte("[server]\nlevel=debug\nreplica.host=replica\n"), &dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dst.Server.Common == nil || dst.Server.Level != "debug" || dst.Server.Replica == nil || dst.Server.Replica.Host != "replica" {
+		t.Fatalf("got %+v", dst.Server)
+	}
+}
+
+func TestRootKeys(t *testing.T) {
+	type section struct {
+		Name string `keyfile:"name"`
+	}
+	type config struct {
+		Root    bool     `keyfile:"root"`
+		Charset string   `keyfile:"charset"`
+		Globs   []string `keyfile:"globs;sep:,"`
+		Section section  `keyfile:"section"`
+	}
+
+	src := "# top\n\nroot=true\ncharset=utf-8\nglobs=*.go,*.md\n\n[section]\nname=x\n"
+
+	var dst config
+	err := NewDecoder(strings.NewReader(src)).Decode(&dst)
+	var rootErr ErrKeyValuePairMustBeContainedInAGroup
+	if !errors.As(err, &rootErr) || rootErr.LineNumber != 3 {
+		t.Fatalf("got %v, want ErrKeyValuePairMustBeContainedInAGroup", err)
+	}
+
+	dec := NewDecoder(strings.NewReader(src))
+	dec.AllowRootKeys()
+	dec.DisallowUnknownFields()
+	err = dec.Decode(&dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := config{Root: true, Charset: "utf-8", Globs: []string{"*.go", "*.md"}, Section: section{Name: "x"}}
+	if !reflect.DeepEqual(dst, want) {
+		t.Fatalf("got %+v, want %+v", dst, want)
+	}
+
+	var buf strings.Builder
+	enc := NewEncoder(&buf)
+	enc.AllowRootKeys()
+	enc.SetOrder(DeclarationOrder)
+	enc.SetHeader("top")
+	err = enc.Encode(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != src {
+		t.Fatalf("got %q, want %q", buf.String(), src)
+	}
+
+	// The root group can also be decoded into a struct field
+	var dst2 struct {
+		Root    map[string]string `keyfile:",root"`
+		Section section           `keyfile:"section"`
+	}
+	dec = NewDecoder(strings.NewReader(src))
+	dec.AllowRootKeys()
+	dec.DisallowUnknownFields()
+	err = dec.Decode(&dst2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantRoot := map[string]string{"root": "true", "charset": "utf-8", "globs": "*.go,*.md"}
+	if !reflect.DeepEqual(dst2.Root, wantRoot) {
+		t.Fatalf("got %v, want %v", dst2.Root, wantRoot)
+	}
+
+	// Root keys that are not decoded are unknown
+	var dst3 struct {
+		Section section `keyfile:"section"`
+	}
+	dec = NewDecoder(strings.NewReader(src))
+	dec.AllowRootKeys()
+	dec.DisallowUnknownFields()
+	err = dec.Decode(&dst3)
+	if !errors.Is(err, ErrUnknownKey{Position: Position{LineNumber: 3, Column: 1, Key: "root"}}) {
+		t.Fatalf("got %v, want ErrUnknownKey", err)
+	}
+
+	// A map model has the root keys under the empty name
+	var dst4 map[string]map[string]string
+	dec = NewDecoder(strings.NewReader(src))
+	dec.AllowRootKeys()
+	dec.DisallowUnknownFields()
+	err = dec.Decode(&dst4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantMap := map[string]map[string]string{"": wantRoot, "section": {"name": "x"}}
+	if !reflect.DeepEqual(dst4, wantMap) {
+		t.Fatalf("got %v, want %v", dst4, wantMap)
+	}
+	buf.Reset()
+	enc = NewEncoder(&buf)
+	enc.AllowRootKeys()
+	err = enc.Encode(wantMap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantData := "charset=utf-8\nglobs=*.go,*.md\nroot=true\n\n[section]\nname=x\n"
+	if buf.String() != wantData {
+		t.Fatalf("got %q, want %q", buf.String(), wantData)
+	}
+}
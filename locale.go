@@ -0,0 +1,97 @@
+package keyfile
+
+import (
+	"cmp"
+	"os"
+	"slices"
+	"strings"
+)
+
+// LocaleString is a string with translations, as written with the
+// key[locale] syntax. The untranslated value is stored under the empty locale.
+type LocaleString map[string]string
+
+// Get returns the translation for the locale, falling back as described by
+// the Desktop Entry specification:
+//
+//	lang_COUNTRY@MODIFIER, lang_COUNTRY, lang@MODIFIER, lang, untranslated
+//
+// If locale is empty, the locale of the process is used (see Locales).
+func (s LocaleString) Get(locale string) string {
+	for _, variant := range localeVariants(locale) {
+		if v, ok := s[variant]; ok {
+			return v
+		}
+	}
+	return s[""]
+}
+
+// GetLocaleString returns the translation of the key for the locale, with the
+// same fallback rules as LocaleString.Get.
+func (doc *Document) GetLocaleString(group, key, locale string) (string, error) {
+	if !doc.hasGroup(group) {
+		return "", ErrGroupNotFound{Position: Position{Group: group}}
+	}
+	for _, variant := range append(localeVariants(locale), "") {
+		if node := doc.lookup(group, key, variant); node != nil {
+			return unescapeAt(node.value, "", doc.dialect, node.valuePosition("", group), node.line())
+		}
+	}
+	return "", ErrKeyNotFound{Position: Position{Group: group, Key: key}}
+}
+
+// SetLocaleString sets the translation of the key for the locale.
+func (doc *Document) SetLocaleString(group, key, locale, value string) {
+	doc.set(group, key, locale, doc.dialect.escape(value))
+}
+
+// Locales returns the message locales of the process in order of preference,
+// read from the LANGUAGE, LC_ALL, LC_MESSAGES and LANG environment variables.
+func Locales() []string {
+	locales := make([]string, 0)
+	if language := os.Getenv("LANGUAGE"); language != "" {
+		locales = append(locales, strings.Split(language, ":")...)
+	}
+	if locale := cmp.Or(os.Getenv("LC_ALL"), os.Getenv("LC_MESSAGES"), os.Getenv("LANG")); locale != "" {
+		locales = append(locales, locale)
+	}
+	return locales
+}
+
+// localeVariants returns the locale names to look up for the locale, most
+// specific first. The encoding part of the locale is ignored.
+func localeVariants(locale string) []string {
+	locales := []string{locale}
+	if locale == "" {
+		locales = Locales()
+	}
+
+	variants := make([]string, 0)
+	add := func(variant string) {
+		if !slices.Contains(variants, variant) {
+			variants = append(variants, variant)
+		}
+	}
+
+	for _, locale := range locales {
+		lang, modifier, _ := strings.Cut(locale, "@")
+		lang, _, _ = strings.Cut(lang, ".")
+		lang, country, _ := strings.Cut(lang, "_")
+		if lang == "" || lang == "C" || lang == "POSIX" {
+			continue
+		}
+
+		if country != "" && modifier != "" {
+			add(lang + "_" + country + "@" + modifier)
+		}
+		if country != "" {
+			add(lang + "_" + country)
+		}
+		if modifier != "" {
+			add(lang + "@" + modifier)
+		}
+		add(lang)
+	}
+
+	return variants
+}
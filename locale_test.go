@@ -0,0 +1,71 @@
+package keyfile
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLocaleString(t *testing.T) {
+	src := `[Desktop Entry]
+Name=Files
+Name[de]=Dateien
+Name[de_AT]=Dateien (AT)
+Name[sr@latin]=Datoteke
+Name[pt_BR]=Arquivos
+`
+	doc, err := ParseDocument([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var config struct {
+		Entry struct {
+			Name LocaleString `keyfile:"Name"`
+		} `keyfile:"Desktop Entry"`
+	}
+	err = Unmarshal([]byte(src), &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		locale string
+		env    string
+		want   string
+	}{
+		{name: "exact", locale: "de_AT", want: "Dateien (AT)"},
+		{name: "country fallback", locale: "de_AT@euro", want: "Dateien (AT)"},
+		{name: "language fallback", locale: "de_DE.UTF-8", want: "Dateien"},
+		{name: "modifier fallback", locale: "sr_RS@latin", want: "Datoteke"},
+		{name: "untranslated", locale: "fr_FR", want: "Files"},
+		{name: "c locale", locale: "C.UTF-8", want: "Files"},
+		{name: "process locale", env: "pt_BR.UTF-8", want: "Arquivos"},
+		{name: "empty process locale", env: "", want: "Files"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("LANGUAGE", "")
+			t.Setenv("LC_ALL", "")
+			t.Setenv("LC_MESSAGES", "")
+			t.Setenv("LANG", tt.env)
+
+			got, err := doc.GetLocaleString("Desktop Entry", "Name", tt.locale)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+			if got := config.Entry.Name.Get(tt.locale); got != tt.want {
+				t.Fatalf("field: got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	_, err = doc.GetLocaleString("Desktop Entry", "Comment", "de")
+	if !errors.Is(err, ErrKeyNotFound{Position: Position{Group: "Desktop Entry", Key: "Comment"}}) {
+		t.Fatal(err)
+	}
+}
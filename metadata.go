@@ -0,0 +1,93 @@
+package keyfile
+
+import "fmt"
+
+// MetaData describes the keys of the document read by Decode: which keys were
+// defined, on which line, and which of them were not decoded into a field.
+type MetaData struct {
+	doc          *Document
+	decodedNodes map[*Node]bool
+}
+
+// Key is a key defined in a document. Locale is empty for untranslated values.
+type Key struct {
+	Group      string
+	Key        string
+	Locale     string
+	LineNumber int
+}
+
+// String returns the key like "[Group] Key[Locale]". Keys of the root group
+// have no group part.
+func (k Key) String() string {
+	key := k.Key
+	if k.Locale != "" {
+		key = fmt.Sprintf("%s[%s]", k.Key, k.Locale)
+	}
+	if k.Group == "" {
+		return key
+	}
+	return fmt.Sprintf("[%s] %s", k.Group, key)
+}
+
+// MetaData returns the metadata of the last call to Decode.
+func (dec *Decoder) MetaData() MetaData {
+	return MetaData{doc: dec.doc, decodedNodes: dec.decodedNodes}
+}
+
+// IsDefined reports whether the key is defined in the group, even if its
+// value is empty or zero. If key is empty, it reports whether the group is
+// defined.
+func (md MetaData) IsDefined(group, key string) bool {
+	if md.doc == nil {
+		return false
+	}
+	if key == "" {
+		return md.doc.hasGroup(group)
+	}
+	return md.doc.lookup(group, key, "") != nil
+}
+
+// LineNumber returns the line that defines the value of the key, or 0 if the
+// key is not defined.
+func (md MetaData) LineNumber(group, key string) int {
+	if md.doc == nil {
+		return 0
+	}
+	if node := md.doc.lookup(group, key, ""); node != nil {
+		return node.lineNumber
+	}
+	return 0
+}
+
+// Keys returns every key defined in the document in source order. When a key
+// is repeated, only the definition that wins is returned.
+func (md MetaData) Keys() []Key {
+	return md.keys(func(*Node) bool { return true })
+}
+
+// Undecoded returns the keys that were not decoded into any field.
+func (md MetaData) Undecoded() []Key {
+	return md.keys(func(node *Node) bool { return !md.decodedNodes[node] })
+}
+
+func (md MetaData) keys(filter func(*Node) bool) []Key {
+	keys := make([]Key, 0)
+	if md.doc == nil {
+		return keys
+	}
+	for _, group := range md.doc.groups {
+		for _, node := range group.nodes {
+			if node.kind != EntryNode || md.doc.lookup(group.name, node.key, node.locale) != node || !filter(node) {
+				continue
+			}
+			keys = append(keys, Key{
+				Group:      group.name,
+				Key:        node.key,
+				Locale:     node.locale,
+				LineNumber: node.lineNumber,
+			})
+		}
+	}
+	return keys
+}
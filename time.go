@@ -0,0 +1,62 @@
+package keyfile
+
+import (
+	"cmp"
+	"reflect"
+	"time"
+)
+
+var (
+	durationType = reflect.TypeFor[time.Duration]()
+	timeType     = reflect.TypeFor[time.Time]()
+	locationType = reflect.TypeFor[*time.Location]()
+)
+
+// isTimeType reports whether the type is a time.Duration, a time.Time or a
+// *time.Location, which are written in their text form.
+func isTimeType(rt reflect.Type) bool {
+	return rt == durationType || rt == timeType || rt == locationType
+}
+
+// timeLayout returns the layout of the layout tag, or RFC 3339.
+func timeLayout(tag reflect.StructTag) string {
+	return cmp.Or(tag.Get("layout"), time.RFC3339Nano)
+}
+
+// decodeTime decodes a duration like "1h30m", a time in the layout of the
+// field, or the IANA name of a location. An empty location is nil, as that is
+// how a nil location is written.
+func (dec *Decoder) decodeTime(rt reflect.Type, value string) (reflect.Value, error) {
+	var v any
+	var err error
+	switch rt {
+	case durationType:
+		v, err = time.ParseDuration(value)
+	case timeType:
+		v, err = time.Parse(timeLayout(dec.currentField.Tag), value)
+	case locationType:
+		if value == "" {
+			return reflect.Zero(rt), nil
+		}
+		v, err = time.LoadLocation(value)
+	}
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	return reflect.ValueOf(v), nil
+}
+
+func (enc *Encoder) encodeTime(rv reflect.Value) string {
+	switch v := rv.Interface().(type) {
+	case time.Duration:
+		return v.String()
+	case time.Time:
+		return enc.syntax().escape(v.Format(timeLayout(enc.currentField.Tag)))
+	case *time.Location:
+		if v == nil {
+			return ""
+		}
+		return v.String()
+	}
+	return ""
+}
@@ -0,0 +1,74 @@
+package keyfile
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTime(t *testing.T) {
+	type config struct {
+		Server struct {
+			Timeout  time.Duration   `keyfile:"timeout"`
+			Retries  []time.Duration `keyfile:"retries;sep:,"`
+			Started  time.Time       `keyfile:"started"`
+			Day      time.Time       `keyfile:"day" layout:"2006-01-02"`
+			Stamp    *time.Time      `keyfile:"stamp" layout:"Jan _2 15:04:05"`
+			Location *time.Location  `keyfile:"location"`
+			Local    *time.Location  `keyfile:"local,omitempty"`
+			Zone     *time.Location  `keyfile:"zone"`
+		} `keyfile:"server"`
+	}
+
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	var src config
+	src.Server.Timeout = 90 * time.Second
+	src.Server.Retries = []time.Duration{time.Second, 500 * time.Millisecond}
+	src.Server.Started = time.Date(2024, 5, 1, 10, 30, 0, 500, time.UTC)
+	src.Server.Day = time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	stamp := time.Date(0, 5, 1, 9, 5, 0, 0, time.UTC)
+	src.Server.Stamp = &stamp
+	src.Server.Location = berlin
+
+	data, err := Marshal(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "[server]\nday=2024-05-01\nlocation=Europe/Berlin\nretries=1s,500ms\nstamp=May  1 09:05:00\nstarted=2024-05-01T10:30:00.0000005Z\ntimeout=1m30s\nzone=\n"
+	if string(data) != want {
+		t.Fatalf("got %q, want %q", data, want)
+	}
+
+	var dst config
+	err = Unmarshal(data, &dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(dst, src) {
+		t.Fatalf("got %+v, want %+v", dst.Server, src.Server)
+	}
+
+	tests := []struct {
+		name string
+		src  string
+	}{
+		{name: "duration", src: "[server]\ntimeout=90\n"},
+		{name: "time", src: "[server]\nday=01.05.2024\n"},
+		{name: "location", src: "[server]\nlocation=Nowhere/Unknown\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var dst config
+			err := Unmarshal([]byte(tt.src), &dst)
+			var parseErr ErrCanNotParsed
+			if !errors.As(err, &parseErr) {
+				t.Fatalf("got %v", err)
+			}
+		})
+	}
+}
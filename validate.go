@@ -0,0 +1,178 @@
+package keyfile
+
+import (
+	"cmp"
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Validator is implemented by models and groups that check their values after
+// decoding, for example rules that involve more than one field. The error of a
+// group is returned as an ErrInvalidValue at the position of its header.
+type Validator interface {
+	ValidateKeyFile() error
+}
+
+// validationOptions are the validation options of the keyfile tag in the order
+// they are checked.
+var validationOptions = []string{"min", "max", "len", "regex", "oneof"}
+
+// regexCache holds the compiled patterns of regex options by their source, so
+// that a pattern is compiled once and not on every decode.
+var regexCache sync.Map
+
+func compileRegex(pattern string) (*regexp.Regexp, error) {
+	if rgx, ok := regexCache.Load(pattern); ok {
+		return rgx.(*regexp.Regexp), nil
+	}
+	rgx, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	regexCache.Store(pattern, rgx)
+	return rgx, nil
+}
+
+// validateField checks the decoded value of the current field against the
+// validation options of its tag.
+func (dec *Decoder) validateField(field reflect.Value) error {
+	for _, name := range validationOptions {
+		param, ok := getOption(dec.currentField.Tag, name)
+		if !ok {
+			continue
+		}
+		option := name + ":" + param
+
+		valid, err := checkOption(field, name, param)
+		if err != nil {
+			return ErrInvalidOption{FieldName: dec.currentField.Name, Option: option, Err: err, Position: dec.position()}
+		}
+		if !valid {
+			return ErrInvalidValue{Err: ErrConstraint{Option: option}, Position: dec.position()}
+		}
+	}
+	return nil
+}
+
+// validateGroup calls the Validator of the current group.
+func (dec *Decoder) validateGroup(group reflect.Value) error {
+	validator, ok := group.Addr().Interface().(Validator)
+	if !ok {
+		return nil
+	}
+	err := validator.ValidateKeyFile()
+	if err == nil {
+		return nil
+	}
+
+	pos := Position{FileName: dec.fileName, Group: dec.currentGroupName}
+	if g := dec.doc.Group(dec.currentGroupName); g != nil {
+		pos = g.header.position(dec.fileName, g.name)
+	}
+	return ErrInvalidValue{Err: err, Position: pos}
+}
+
+// validateModel calls the Validator of the model.
+func validateModel(model reflect.Value) error {
+	validator, ok := model.Addr().Interface().(Validator)
+	if !ok {
+		return nil
+	}
+	return validator.ValidateKeyFile()
+}
+
+func checkOption(rv reflect.Value, name, param string) (bool, error) {
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return true, nil
+		}
+		rv = rv.Elem()
+	}
+
+	switch name {
+	case "min", "max", "len":
+		c, err := compareSize(rv, param)
+		if err != nil {
+			return false, err
+		}
+		switch name {
+		case "min":
+			return c >= 0, nil
+		case "max":
+			return c <= 0, nil
+		}
+		return c == 0, nil
+
+	case "regex":
+		rgx, err := compileRegex(param)
+		if err != nil {
+			return false, err
+		}
+		return checkElems(rv, func(elem reflect.Value) (bool, error) {
+			if elem.Kind() != reflect.String {
+				return false, ErrUnsupportedValueType{}
+			}
+			return rgx.MatchString(elem.String()), nil
+		})
+	}
+
+	// oneof
+	values := strings.Split(param, "|")
+	return checkElems(rv, func(elem reflect.Value) (bool, error) {
+		return slices.Contains(values, fmt.Sprint(elem.Interface())), nil
+	})
+}
+
+// compareSize compares a number, a duration, or the length of a string,
+// slice or map with param.
+func compareSize(rv reflect.Value, param string) (int, error) {
+	if rv.Type() == durationType {
+		p, err := time.ParseDuration(param)
+		return cmp.Compare(time.Duration(rv.Int()), p), err
+	}
+
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		p, err := strconv.ParseInt(param, 10, 64)
+		return cmp.Compare(rv.Int(), p), err
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		p, err := strconv.ParseUint(param, 10, 64)
+		return cmp.Compare(rv.Uint(), p), err
+
+	case reflect.Float32, reflect.Float64:
+		p, err := strconv.ParseFloat(param, 64)
+		return cmp.Compare(rv.Float(), p), err
+
+	case reflect.String:
+		p, err := strconv.Atoi(param)
+		return cmp.Compare(utf8.RuneCountInString(rv.String()), p), err
+
+	case reflect.Slice, reflect.Map:
+		p, err := strconv.Atoi(param)
+		return cmp.Compare(rv.Len(), p), err
+	}
+
+	return 0, ErrUnsupportedValueType{}
+}
+
+// checkElems checks a value, or every element of a slice.
+func checkElems(rv reflect.Value, check func(reflect.Value) (bool, error)) (bool, error) {
+	if rv.Kind() != reflect.Slice {
+		return check(rv)
+	}
+	for i := range rv.Len() {
+		valid, err := checkElems(rv.Index(i), check)
+		if err != nil || !valid {
+			return valid, err
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,152 @@
+package keyfile
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+type validatedServer struct {
+	Port    int           `keyfile:"port;min:1;max:65535"`
+	Name    string        `keyfile:"name;len:3"`
+	Mode    string        `keyfile:"mode;oneof:dev|prod"`
+	Host    string        `keyfile:"host;regex:^[a-z.]+$"`
+	Tags    []string      `keyfile:"tags;min:1;max:2;oneof:a|b|c"`
+	Ratio   *float64      `keyfile:"ratio;max:1"`
+	Retries uint          `keyfile:"retries;oneof:1|3|5"`
+	Timeout time.Duration `keyfile:"timeout;min:1s"`
+	Min     int           `keyfile:"min"`
+	Max     int           `keyfile:"max"`
+}
+
+func (s validatedServer) ValidateKeyFile() error {
+	if s.Min > s.Max {
+		return errTestRange
+	}
+	return nil
+}
+
+type validatedConfig struct {
+	Server validatedServer `keyfile:"server"`
+}
+
+func (c *validatedConfig) ValidateKeyFile() error {
+	if c.Server.Mode == "prod" && c.Server.Host == "localhost" {
+		return errTestLocalhost
+	}
+	return nil
+}
+
+var (
+	errTestRange     = errors.New("min is greater than max")
+	errTestLocalhost = errors.New("localhost in production")
+)
+
+func TestDecoderValidation(t *testing.T) {
+	valid := "[server]\nport=80\nname=abc\nmode=dev\nhost=example.com\ntags=a;c\nratio=0.5\nretries=3\n"
+
+	tests := []struct {
+		name string
+		src  string
+		err  error
+	}{
+		{
+			name: "valid",
+			src:  valid,
+		},
+		{
+			name: "min",
+			src:  strings.Replace(valid, "port=80", "port=0", 1),
+			err:  ErrInvalidValue{Err: ErrConstraint{Option: "min:1"}, Position: Position{LineNumber: 2, Column: 6, Group: "server", Key: "port"}},
+		},
+		{
+			name: "string length",
+			src:  strings.Replace(valid, "name=abc", "name=äbcd", 1),
+			err:  ErrInvalidValue{Err: ErrConstraint{Option: "len:3"}, Position: Position{LineNumber: 3, Column: 6, Group: "server", Key: "name"}},
+		},
+		{
+			name: "oneof",
+			src:  strings.Replace(valid, "mode=dev", "mode=test", 1),
+			err:  ErrConstraint{Option: "oneof:dev|prod"},
+		},
+		{
+			name: "regex",
+			src:  strings.Replace(valid, "host=example.com", "host=Example.com", 1),
+			err:  ErrConstraint{Option: "regex:^[a-z.]+$"},
+		},
+		{
+			name: "slice length",
+			src:  strings.Replace(valid, "tags=a;c", "tags=a;b;c", 1),
+			err:  ErrConstraint{Option: "max:2"},
+		},
+		{
+			name: "slice elements",
+			src:  strings.Replace(valid, "tags=a;c", "tags=a;d", 1),
+			err:  ErrConstraint{Option: "oneof:a|b|c"},
+		},
+		{
+			name: "pointer",
+			src:  strings.Replace(valid, "ratio=0.5", "ratio=1.5", 1),
+			err:  ErrConstraint{Option: "max:1"},
+		},
+		{
+			name: "number oneof",
+			src:  strings.Replace(valid, "retries=3", "retries=4", 1),
+			err:  ErrConstraint{Option: "oneof:1|3|5"},
+		},
+		{
+			name: "duration",
+			src:  valid + "timeout=500ms\n",
+			err:  ErrConstraint{Option: "min:1s"},
+		},
+		{
+			name: "group validator",
+			src:  valid + "min=2\nmax=1\n",
+			err:  ErrInvalidValue{Err: errTestRange, Position: Position{LineNumber: 1, Column: 1, Group: "server"}},
+		},
+		{
+			name: "model validator",
+			src:  strings.Replace(strings.Replace(valid, "mode=dev", "mode=prod", 1), "host=example.com", "host=localhost", 1),
+			err:  errTestLocalhost,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var dst validatedConfig
+			err := Unmarshal([]byte(tt.src), &dst)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestDecoderInvalidOption(t *testing.T) {
+	var dst struct {
+		Server struct {
+			Enabled bool `keyfile:"enabled;min:1"`
+		} `keyfile:"server"`
+	}
+	err := Unmarshal([]byte("[server]\nenabled=true\n"), &dst)
+	var optionErr ErrInvalidOption
+	if !errors.As(err, &optionErr) || optionErr.Option != "min:1" || !errors.Is(err, ErrUnsupportedValueType{}) ||
+		optionErr.Position != (Position{LineNumber: 2, Column: 9, Group: "server", Key: "enabled"}) {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestCompileRegexCache(t *testing.T) {
+	first, err := compileRegex("^[a-z]+$")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := compileRegex("^[a-z]+$")
+	if err != nil || first != second {
+		t.Fatalf("pattern compiled again: %v", err)
+	}
+	if _, err := compileRegex("["); err == nil {
+		t.Fatal("invalid pattern compiled")
+	}
+}